@@ -1,305 +1,164 @@
 package main
 
 import (
-	"archive/tar"
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"flag"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/archive"
-	"github.com/docker/docker/pkg/stdcopy"
-	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/mtstnt/runner/pkg/runner"
+	"github.com/mtstnt/runner/pkg/server"
+	"github.com/mtstnt/runner/util"
 )
 
+// jsonResult is the output of the -json flag.
+type jsonResult struct {
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out"`
+	OOMKilled  bool   `json:"oom_killed"`
+	WallTimeMs int64  `json:"wall_time_ms"`
+}
+
 func main() {
 	if err := run(); err != nil {
 		log.Fatalln(err)
 	}
 }
 
-func writeFileToTarWriter(tw *tar.Writer, filename string, srcFilename string) error {
-	fp, err := os.Open(srcFilename)
-	if err != nil {
-		return err
-	}
-	defer fp.Close()
-
-	v := new(strings.Builder)
-	if _, err := io.Copy(v, fp); err != nil {
-		return err
-	}
-
-	fc := v.String()
-
-	header := tar.Header{
-		Name: filename,
-		Mode: 0777,
-		Size: int64(len(fc)),
-	}
-	if err := tw.WriteHeader(&header); err != nil {
-		return err
-	}
-	if _, err := tw.Write([]byte(fc)); err != nil {
-		return err
-	}
-	return nil
-}
-
-func loadFilesRecursive(pathname string, mapRef map[string]string) error {
-	dirEntries, err := os.ReadDir(pathname)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range dirEntries {
-		if entry.IsDir() {
-			if err := loadFilesRecursive(pathname+"/"+entry.Name(), mapRef); err != nil {
-				return err
-			}
-		} else {
-			f, err := os.ReadFile(pathname + "/" + entry.Name())
-			if err != nil {
-				return err
-			}
-			mapRef[entry.Name()] = string(f)
-		}
-	}
-
-	return nil
-}
-
-func loadSourceFiles(pathname string) (map[string]string, error) {
-	var sourceFiles = make(map[string]string)
-	loadFilesRecursive(pathname, sourceFiles)
-	return sourceFiles, nil
-}
-
-func createTarfileOfCode() (io.Reader, error) {
-	sourceFiles, err := loadSourceFiles("examples/python")
-	if err != nil {
-		return nil, err
-	}
-	m, err := json.MarshalIndent(sourceFiles, "", "\t")
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println(string(m))
-
-	var buffer bytes.Buffer
-
-	tw := tar.NewWriter(&buffer)
-	writeFileToTarWriter(tw, "timer.sh", "runner/timer.sh")
-
-	for filePath, fileContents := range sourceFiles {
-		header := tar.Header{
-			Name: filePath,
-			Mode: 0777,
-			Size: int64(len(fileContents)),
-		}
-		if err := tw.WriteHeader(&header); err != nil {
-			return nil, err
-		}
-		if _, err := tw.Write([]byte(fileContents)); err != nil {
-			return nil, err
-		}
-	}
-
-	tw.Close()
-
-	return bytes.NewReader(buffer.Bytes()), nil
-}
-
-func disposeContainer(
-	ctx context.Context,
-	dc *client.Client,
-	containerID string,
-) {
-	if err := dc.ContainerRemove(
-		ctx,
-		containerID,
-		types.ContainerRemoveOptions{},
-	); err != nil {
-		panic(err)
+func run() (err error) {
+	sourceDir := flag.String("src", "examples/python", "directory containing the source files to run")
+	lang := flag.String("lang", "", "language of the source files, detected from their file names if empty, falling back to python")
+	entry := flag.String("entry", "", "file the program starts from, defaults to the language's main file")
+	jsonOutput := flag.Bool("json", false, "print the result as a single JSON object")
+	buildOnly := flag.Bool("build-only", false, "build the runner image and exit without running anything")
+	buildContext := flag.String("build-context", "runner/", "directory the runner image is built from")
+	dockerfile := flag.String("dockerfile", "Dockerfile", "name of the Dockerfile within the build context")
+	timerScript := flag.String("timer", "runner/timer.sh", "wrapper script packed as timer.sh, empty to run commands unwrapped")
+	pullImage := flag.String("pull", "", "pull this image as the runner image instead of building it")
+	network := flag.String("network", "", `network to connect the program to, e.g. "bridge", none by default`)
+	verbose := flag.Bool("verbose", false, "print debug output, such as the names of the packed source files, to stderr")
+	keep := flag.Bool("keep", false, "keep the container of a failed run for inspection")
+	httpAddr := flag.String("http", "", "serve the HTTP API on this address instead of running once")
+	stdinTar := flag.Bool("stdin-tar", false, "read the source files as a tar, gzip-compressed tar or zip from stdin instead of -src")
+	strict := flag.Bool("strict", false, "refuse to run on a daemon that is neither rootless nor user-namespaced")
+	socket := flag.String("socket", "", "daemon socket to connect to, such as a rootless Docker or Podman socket, instead of the environment's")
+	apiVersion := flag.String("api-version", "", "Docker API version to use, negotiated if empty")
+	cmd := flag.String("cmd", "", "command to run inside /code instead of timer.sh, split on spaces")
+	flag.Parse()
+
+	if *verbose {
+		util.DebugEnabled = true
+	}
+
+	// Cancel the run on Ctrl-C or SIGTERM. Its container is removed below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := []runner.Option{
+		runner.WithBuildOutput(os.Stderr),
+		runner.WithBuildContext(*buildContext, *dockerfile),
+		runner.WithPullImage(*pullImage),
+		runner.WithTimerScript(*timerScript),
+	}
+	if *strict {
+		opts = append(opts, runner.WithStrictIsolation())
+	}
+	var r *runner.Runner
+	if *socket != "" {
+		r, err = runner.NewFromSocket(*socket, *apiVersion, opts...)
+	} else {
+		r, err = runner.NewFromEnvVersion(*apiVersion, opts...)
 	}
-}
-
-func run() error {
-	ctx := context.Background()
-
-	dc, err := client.NewClientWithOpts(
-		client.WithAPIVersionNegotiation(),
-		client.WithHostFromEnv(),
-	)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		err = errors.Join(err, r.Close())
+	}()
 
-	// Check if the image runner does not exist.
-	filters := filters.NewArgs(
-		filters.KeyValuePair{
-			Key:   "reference",
-			Value: "runner",
-		},
-	)
-
-	var (
-		imageID string
-	)
-
-	result, err := dc.ImageList(
-		ctx,
-		types.ImageListOptions{
-			All:     true,
-			Filters: filters,
-		},
-	)
-	if err != nil {
-		return err
+	if *buildOnly {
+		return r.EnsureImage(ctx)
 	}
-
-	if len(result) == 0 {
-		tarfile, err := archive.TarWithOptions("runner/", &archive.TarOptions{})
+	if *httpAddr != "" {
+		warnings, err := r.SecurityWarnings(ctx)
 		if err != nil {
 			return err
 		}
-
-		if _, err = dc.ImageBuild(ctx,
-			tarfile,
-			types.ImageBuildOptions{
-				Tags:   []string{"runner:latest"},
-				Remove: true,
-			},
-		); err != nil {
-			fmt.Println("error build")
-			return err
+		for _, w := range warnings {
+			log.Printf("warning: %s", w)
 		}
+		return serve(ctx, *httpAddr, r)
+	}
 
-		r, err := dc.ImageList(
-			ctx,
-			types.ImageListOptions{
-				All:     true,
-				Filters: filters,
-			},
-		)
-		if err != nil {
-			return err
-		}
+	req := runner.RunRequest{
+		SourceDir: *sourceDir,
+		Language:  *lang,
+		EntryFile: *entry,
+		Cmd:       strings.Fields(*cmd),
+		Args:      flag.Args(),
+		Network:   *network,
 
-		imageID = r[0].ID
-	} else {
-		imageID = result[0].ID
+		KeepOnFailure: *keep,
 	}
 
-	var (
-		memoryLimit = 10_000_000
-	)
-	createResp, err := dc.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image:           imageID,
-			NetworkDisabled: true,
-			WorkingDir:      "/code",
-			Cmd: []string{
-				"sh", "./timer.sh",
-			},
-		},
-		&container.HostConfig{
-			Resources: container.Resources{
-				Memory:  int64(memoryLimit),
-				Devices: nil,
-			},
-			Privileged: false,
-		},
-		&network.NetworkingConfig{},
-		&v1.Platform{},
-		"runner",
-	)
-	if err != nil {
-		return err
+	var result runner.RunResult
+	if *stdinTar {
+		// Stdin carries the archive, so the program gets none.
+		result, err = r.RunArchive(ctx, req, os.Stdin)
+	} else {
+		// Only forward stdin when it is piped in, not when it is a terminal.
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+			req.Stdin = os.Stdin
+		}
+		result, err = r.Run(ctx, req)
 	}
-
-	containerID := createResp.ID
-
-	content, err := createTarfileOfCode()
 	if err != nil {
-		disposeContainer(ctx, dc, containerID)
 		return err
 	}
 
-	if err := dc.CopyToContainer(
-		ctx,
-		containerID,
-		"/code",
-		content,
-		types.CopyToContainerOptions{
-			AllowOverwriteDirWithFile: true,
-		},
-	); err != nil {
-		disposeContainer(ctx, dc, containerID)
-		return err
-	}
-
-	if err := dc.ContainerStart(
-		ctx,
-		containerID,
-		types.ContainerStartOptions{},
-	); err != nil {
-		disposeContainer(ctx, dc, containerID)
-		return err
+	if *jsonOutput {
+		return printJSON(os.Stdout, result)
 	}
 
-	wr, errCh := dc.ContainerWait(
-		ctx,
-		containerID,
-		container.WaitConditionNotRunning,
-	)
+	return result.Format(os.Stdout)
+}
 
-	select {
-	case c := <-wr:
-		if c.Error != nil {
-			return err
-		}
-	case err := <-errCh:
-		return err
-	}
+// printJSON writes result to w as the single JSON object of the -json flag.
+func printJSON(w io.Writer, result runner.RunResult) error {
+	return json.NewEncoder(w).Encode(jsonResult{
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		ExitCode:   result.ExitCode,
+		TimedOut:   result.TimedOut,
+		OOMKilled:  result.OOMKilled,
+		WallTimeMs: result.WallTime.Milliseconds(),
+	})
+}
 
-	f, err := dc.ContainerLogs(
-		ctx,
-		containerID,
-		types.ContainerLogsOptions{
-			ShowStdout: true,
-			ShowStderr: true,
-			Details:    true,
-		},
-	)
-	if err != nil {
-		return err
+// serve runs the HTTP API until ctx is cancelled.
+func serve(ctx context.Context, addr string, r *runner.Runner) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: server.New(r),
 	}
 
-	var (
-		bufStdout = bytes.NewBuffer(nil)
-		bufStderr = bytes.NewBuffer(nil)
-	)
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
 
-	if _, err := stdcopy.StdCopy(bufStdout, bufStderr, f); err != nil {
+	log.Printf("listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
-
-	// TODO: Always slice from index 9 upwards to remove SIZE infos.
-	// Refer to client.ContainerLogs docs.
-	fmt.Println("STDOUT:\n" + bufStdout.String())
-	fmt.Println("STDERR:\n" + bufStderr.String())
-
-	disposeContainer(ctx, dc, containerID)
 	return nil
 }
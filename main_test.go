@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mtstnt/runner/pkg/runner"
+)
+
+func TestPrintJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := printJSON(&buf, runner.RunResult{
+		Stdout:   "hello\n",
+		Stderr:   "warning\n",
+		ExitCode: 2,
+		TimedOut: true,
+		WallTime: 1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("printJSON: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output %q is not JSON: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"stdout":       "hello\n",
+		"stderr":       "warning\n",
+		"exit_code":    2.0,
+		"timed_out":    true,
+		"oom_killed":   false,
+		"wall_time_ms": 1500.0,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+// skipWithoutDaemon skips the test when there is no Docker daemon or in short
+// mode.
+func skipWithoutDaemon(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("needs a Docker daemon")
+	}
+	r, err := runner.NewFromEnv()
+	if err != nil {
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = r.Ping(ctx)
+	r.Close()
+	if err != nil {
+		t.Skipf("no Docker daemon: %v", err)
+	}
+}
+
+// runCLI runs the CLI with args, feeding it stdin unless nil, and returns what
+// it printed to stdout.
+func runCLI(t *testing.T, stdin io.Reader, args ...string) []byte {
+	t.Helper()
+	osArgs, commandLine, osStdin, osStdout := os.Args, flag.CommandLine, os.Stdin, os.Stdout
+	defer func() {
+		os.Args, flag.CommandLine, os.Stdin, os.Stdout = osArgs, commandLine, osStdin, osStdout
+	}()
+	os.Args = append([]string{"runner"}, args...)
+	flag.CommandLine = flag.NewFlagSet("runner", flag.ContinueOnError)
+
+	if stdin != nil {
+		inR, inW, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inR.Close()
+		go func() {
+			io.Copy(inW, stdin)
+			inW.Close()
+		}()
+		os.Stdin = inR
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = outW
+	output := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(outR)
+		output <- b
+	}()
+
+	err = run()
+	outW.Close()
+	b := <-output
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return b
+}
+
+func TestRunJSON(t *testing.T) {
+	skipWithoutDaemon(t)
+
+	b := runCLI(t, nil, "-json", "-src", "examples/python")
+	var got jsonResult
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("output %q is not JSON: %v", b, err)
+	}
+}
+
+func TestRunStdinTar(t *testing.T) {
+	skipWithoutDaemon(t)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for name, contents := range map[string]string{
+		"main.py":         "from lib import greeting\nprint(greeting)\n",
+		"lib/__init__.py": "greeting = 'from the tar'\n",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))})
+		io.WriteString(tw, contents)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := runCLI(t, &archive, "-json", "-stdin-tar", "-lang", "python")
+	var got jsonResult
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("output %q is not JSON: %v", b, err)
+	}
+	if got.Stdout != "from the tar\n" || got.ExitCode != 0 {
+		t.Errorf("stdout = %q, exit code %d, want the archived program run", got.Stdout, got.ExitCode)
+	}
+}
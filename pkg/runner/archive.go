@@ -0,0 +1,611 @@
+package runner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mtstnt/runner/util"
+)
+
+const (
+	// memoryFileMode is the mode of source files that only exist in memory.
+	memoryFileMode = 0644
+
+	// timerName is the name the timer.sh wrapper is packed as, relative to
+	// /code.
+	timerName = "timer.sh"
+)
+
+// sourceFile is a file or directory of the submission. Files are read only
+// once they are packed.
+type sourceFile struct {
+	// Name is the slash-separated path relative to /code.
+	Name string
+	Mode fs.FileMode
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+// tarHeader returns the header packing file into a tar.
+func (file sourceFile) tarHeader() *tar.Header {
+	if file.Mode.IsDir() {
+		return &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     file.Name + "/",
+			Mode:     int64(file.Mode.Perm()),
+		}
+	}
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     file.Name,
+		Mode:     int64(file.Mode.Perm()),
+		Size:     file.Size,
+	}
+}
+
+// writeTo packs file into tw, reading its contents unless it is a directory.
+func (file sourceFile) writeTo(tw *tar.Writer) error {
+	if err := tw.WriteHeader(file.tarHeader()); err != nil {
+		return err
+	}
+	if file.Mode.IsDir() {
+		return nil
+	}
+
+	fp, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	if _, err := io.CopyN(tw, fp, file.Size); err != nil {
+		return fmt.Errorf("pack %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// hostSourceFile returns the sourceFile packing the host file at pathname as
+// name. Symlinks are followed.
+func hostSourceFile(name, pathname string) (sourceFile, error) {
+	info, err := os.Stat(pathname)
+	if err != nil {
+		return sourceFile{}, err
+	}
+	return sourceFile{
+		Name: name,
+		Mode: info.Mode(),
+		Size: info.Size(),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(pathname)
+		},
+	}, nil
+}
+
+// hasFile reports whether sourceFiles contain a regular file named name, a clean
+// slash-separated path.
+func hasFile(sourceFiles []sourceFile, name string) bool {
+	for _, file := range sourceFiles {
+		if path.Clean(file.Name) == name && file.Mode.IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceNames returns the sorted names of the regular files among sourceFiles
+// that have the extension ext.
+func sourceNames(sourceFiles []sourceFile, ext string) []string {
+	var names []string
+	for _, file := range sourceFiles {
+		name := path.Clean(file.Name)
+		if file.Mode.IsRegular() && path.Ext(name) == ext {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memorySourceFiles returns the sourceFiles of files held in memory, keyed by
+// their path relative to /code.
+func memorySourceFiles(files map[string][]byte) []sourceFile {
+	sourceFiles := make([]sourceFile, 0, len(files))
+	for name, contents := range files {
+		contents := contents
+		sourceFiles = append(sourceFiles, sourceFile{
+			Name: name,
+			Mode: memoryFileMode,
+			Size: int64(len(contents)),
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(contents)), nil
+			},
+		})
+	}
+	return sourceFiles
+}
+
+// sourceLimits bounds how much of a submission is read, whether from a source
+// directory, an archive or memory.
+type sourceLimits struct {
+	maxTotalBytes int64
+	maxFileBytes  int64
+	maxFiles      int
+
+	totalBytes int64
+	files      int
+}
+
+// newSourceLimits returns the limits of req, applying the defaults of
+// RunRequest.MaxSourceBytes, MaxFileBytes and MaxFiles.
+func newSourceLimits(req RunRequest) (sourceLimits, error) {
+	limits := sourceLimits{
+		maxTotalBytes: req.MaxSourceBytes,
+		maxFileBytes:  req.MaxFileBytes,
+		maxFiles:      req.MaxFiles,
+	}
+	if limits.maxTotalBytes == 0 {
+		limits.maxTotalBytes = defaultMaxSource
+	}
+	if limits.maxFileBytes == 0 {
+		limits.maxFileBytes = defaultMaxFile
+	}
+	if limits.maxFiles == 0 {
+		limits.maxFiles = defaultMaxFiles
+	}
+	if limits.maxTotalBytes < 0 || limits.maxFileBytes < 0 {
+		return sourceLimits{}, fmt.Errorf("source size limits of %d and %d bytes may not be negative", limits.maxTotalBytes, limits.maxFileBytes)
+	}
+	if limits.maxFiles < 0 {
+		return sourceLimits{}, fmt.Errorf("file limit of %d is negative", limits.maxFiles)
+	}
+	return limits, nil
+}
+
+// count accounts for another file or directory, failing once there are more
+// than maxFiles of them.
+func (l *sourceLimits) count() error {
+	l.files++
+	if l.files > l.maxFiles {
+		return fmt.Errorf("%w: source exceeds the limit of %d files", ErrSourceTooLarge, l.maxFiles)
+	}
+	return nil
+}
+
+// add accounts for a file of size bytes, failing once a limit is exceeded.
+func (l *sourceLimits) add(name string, size int64) error {
+	if size > l.maxFileBytes {
+		return fmt.Errorf("%w: %s is %d bytes, exceeding the per-file limit of %d bytes", ErrSourceTooLarge, name, size, l.maxFileBytes)
+	}
+	l.totalBytes += size
+	if l.totalBytes > l.maxTotalBytes {
+		return fmt.Errorf("%w: source exceeds the total size limit of %d bytes", ErrSourceTooLarge, l.maxTotalBytes)
+	}
+	return nil
+}
+
+// checkMemorySourceFiles checks that the files held in memory stay within
+// limits.
+func checkMemorySourceFiles(files map[string][]byte, limits *sourceLimits) error {
+	for name, contents := range files {
+		if err := limits.count(); err != nil {
+			return err
+		}
+		if err := limits.add(name, int64(len(contents))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFilesRecursive appends every file below root/relpath to files, skipping
+// those matching exclude. root must be an absolute path without symlinks.
+// Symlinks are only followed to regular files inside root.
+func loadFilesRecursive(root string, relpath string, files *[]sourceFile, limits *sourceLimits, exclude []string) error {
+	dirEntries, err := os.ReadDir(filepath.Join(root, relpath))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range dirEntries {
+		entryPath := path.Join(relpath, entry.Name())
+		fullPath := filepath.Join(root, filepath.FromSlash(entryPath))
+		if excluded(entryPath, exclude) {
+			continue
+		}
+		if err := limits.count(); err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			*files = append(*files, sourceFile{
+				Name: entryPath,
+				Mode: info.Mode(),
+			})
+			if err := loadFilesRecursive(root, entryPath, files, limits, exclude); err != nil {
+				return err
+			}
+			continue
+		case entry.Type()&fs.ModeSymlink != 0:
+			if err := checkSymlink(root, fullPath); err != nil {
+				return err
+			}
+		case !entry.Type().IsRegular():
+			return fmt.Errorf("%s is not a regular file", entryPath)
+		}
+
+		// Stat follows symlinks, so this is the size of the file actually read.
+		file, err := hostSourceFile(entryPath, fullPath)
+		if err != nil {
+			return err
+		}
+		if err := limits.add(entryPath, file.Size); err != nil {
+			return err
+		}
+		*files = append(*files, file)
+	}
+
+	return nil
+}
+
+// defaultExclude is skipped when loading a source directory unless
+// RunRequest.Exclude says otherwise.
+var defaultExclude = []string{".git", "__pycache__"}
+
+// excluded reports whether the slash-separated relative path name, or its
+// base name, matches one of the patterns.
+func excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExclude checks that every pattern is well-formed.
+func validateExclude(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// sourceDirNames returns the slash-separated paths, relative to dir, of up to
+// maxFiles files below it, skipping those matching exclude. It lists names
+// only, to detect the language before the directory is loaded, and returns
+// what it found so far on errors, which loading reports.
+func sourceDirNames(dir string, exclude []string, maxFiles int) []string {
+	var names []string
+	filepath.WalkDir(dir, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil || pathname == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, pathname)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded(rel, exclude) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			names = append(names, rel)
+		}
+		if len(names) >= maxFiles {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return names
+}
+
+// checkSymlink checks that the symlink at pathname resolves to a regular file
+// inside root.
+func checkSymlink(root string, pathname string) error {
+	target, err := filepath.EvalSymlinks(pathname)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink %s points outside the source root", pathname)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("symlink %s does not point to a regular file", pathname)
+	}
+	return nil
+}
+
+// loadSourceFiles lists the files below pathname without reading them yet,
+// failing once they exceed limits. Files and directories matching exclude are
+// skipped.
+func loadSourceFiles(pathname string, limits *sourceLimits, exclude []string) ([]sourceFile, error) {
+	root, err := filepath.Abs(pathname)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load source files from %s: %w", pathname, err)
+	}
+
+	var sourceFiles []sourceFile
+	if err := loadFilesRecursive(root, "", &sourceFiles, limits, exclude); err != nil {
+		return nil, fmt.Errorf("load source files from %s: %w", pathname, err)
+	}
+	return sourceFiles, nil
+}
+
+// validateSourceDir checks that sourceDir is an existing, non-empty directory.
+func validateSourceDir(sourceDir string) error {
+	info, err := os.Stat(sourceDir)
+	if err != nil {
+		return fmt.Errorf("source directory %s: %w", sourceDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("source directory %s is not a directory", sourceDir)
+	}
+
+	dirEntries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return fmt.Errorf("source directory %s: %w", sourceDir, err)
+	}
+	if len(dirEntries) == 0 {
+		return fmt.Errorf("source directory %s: %w", sourceDir, ErrSourceEmpty)
+	}
+	return nil
+}
+
+// createTarfileOfCode packs sourceFiles into a tar along with the timer.sh
+// wrapper read from timerScript, unless timerScript is empty. The tar is
+// produced while it is read, one file at a time, so the submission is never
+// held in memory as a whole. The returned reader must be closed.
+func createTarfileOfCode(sourceFiles []sourceFile, timerScript string) (io.ReadCloser, error) {
+	if util.DebugEnabled {
+		names := make([]string, 0, len(sourceFiles))
+		for _, file := range sourceFiles {
+			names = append(names, file.Name)
+		}
+		util.Debugf(names)
+	}
+
+	if timerScript != "" {
+		timer, err := hostSourceFile(timerName, timerScript)
+		if err != nil {
+			return nil, err
+		}
+		sourceFiles = append([]sourceFile{timer}, sourceFiles...)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		tw := tar.NewWriter(pw)
+		for _, file := range sourceFiles {
+			if err := file.writeTo(tw); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		pw.CloseWithError(tw.Close())
+	}()
+
+	return pr, nil
+}
+
+// validateTimerScript checks that the timer.sh wrapper at pathname is a
+// regular file, so that a missing wrapper fails the run up front rather than
+// while packing.
+func validateTimerScript(pathname string) error {
+	info, err := os.Stat(pathname)
+	if err != nil {
+		return fmt.Errorf("timer script: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("timer script %s is not a regular file", pathname)
+	}
+	return nil
+}
+
+// checkTimerCollision fails if name, a clean slash-separated path, would
+// replace the timer.sh wrapper packed from timerScript.
+func checkTimerCollision(name string, timerScript string) error {
+	if timerScript != "" && name == timerName {
+		return fmt.Errorf("%s is reserved for the timer wrapper", name)
+	}
+	return nil
+}
+
+// validateSourcePath checks that name is a relative path that stays inside
+// /code and returns it in clean form.
+func validateSourcePath(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty source file path")
+	}
+	if path.IsAbs(name) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("source file path %s is absolute", name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("source file path %s escapes the source root", name)
+	}
+	return cleaned, nil
+}
+
+// readArchiveFiles reads the regular files of a tar, gzip-compressed tar or
+// zip archive, detected from its leading bytes, into a map keyed by their
+// validated relative path. Reading fails as soon as the regular files exceed
+// limits; directories are not counted as they are not kept. Intermediate
+// files are written to scratchDir.
+func readArchiveFiles(r io.Reader, scratchDir string, limits *sourceLimits) (map[string][]byte, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return readZipFiles(br, scratchDir, limits)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return readTarFiles(zr, limits)
+	default:
+		return readTarFiles(br, limits)
+	}
+}
+
+func readTarFiles(r io.Reader, limits *sourceLimits) (map[string][]byte, error) {
+	var sourceFiles = make(map[string][]byte)
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar archive: %w", err)
+		}
+		// git archive starts with a pax global header holding the commit ID.
+		// Extended headers are merged into the next entry by tar.Reader, and
+		// skipped like global ones should one come through.
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Typeflag == tar.TypeXHeader {
+			continue
+		}
+
+		name, err := validateSourcePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("archive entry %s is not a regular file", header.Name)
+		}
+
+		f, err := readArchiveEntry(tr, name, header.Size, limits)
+		if err != nil {
+			return nil, fmt.Errorf("read tar archive: %w", err)
+		}
+		sourceFiles[name] = f
+	}
+
+	return sourceFiles, nil
+}
+
+func readZipFiles(r io.Reader, scratchDir string, limits *sourceLimits) (map[string][]byte, error) {
+	// zip needs random access to find its central directory, so the archive
+	// is spooled to disk first, no more of it than the source may take up.
+	fp, err := os.CreateTemp(scratchDir, "archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	size, err := io.Copy(fp, io.LimitReader(r, limits.maxTotalBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("spool zip archive: %w", err)
+	}
+	if size > limits.maxTotalBytes {
+		return nil, fmt.Errorf("%w: zip archive exceeds the total size limit of %d bytes", ErrSourceTooLarge, limits.maxTotalBytes)
+	}
+	zr, err := zip.NewReader(fp, size)
+	if err != nil {
+		return nil, fmt.Errorf("read zip archive: %w", err)
+	}
+
+	var sourceFiles = make(map[string][]byte)
+	for _, zf := range zr.File {
+		name, err := validateSourcePath(zf.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := zf.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return nil, fmt.Errorf("archive entry %s is not a regular file", zf.Name)
+		}
+
+		if zf.UncompressedSize64 > uint64(limits.maxFileBytes) {
+			return nil, fmt.Errorf("%w: %s is %d bytes, exceeding the per-file limit of %d bytes", ErrSourceTooLarge, name, zf.UncompressedSize64, limits.maxFileBytes)
+		}
+		fp, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("read zip archive: %w", err)
+		}
+		f, err := readArchiveEntry(fp, name, int64(zf.UncompressedSize64), limits)
+		fp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read zip archive: %w", err)
+		}
+		sourceFiles[name] = f
+	}
+
+	return sourceFiles, nil
+}
+
+// readArchiveEntry reads the archive entry name, declared to be size bytes,
+// from r once limits allow for it. An entry longer than declared fails rather
+// than being read past the limits.
+func readArchiveEntry(r io.Reader, name string, size int64, limits *sourceLimits) ([]byte, error) {
+	if err := limits.count(); err != nil {
+		return nil, err
+	}
+	if err := limits.add(name, size); err != nil {
+		return nil, err
+	}
+
+	f, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(f)) != size {
+		return nil, fmt.Errorf("%s is not %d bytes long as declared", name, size)
+	}
+	return f, nil
+}
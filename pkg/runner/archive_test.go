@@ -0,0 +1,902 @@
+package runner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mtstnt/runner/util"
+)
+
+// testLimits returns the default source limits.
+func testLimits(t *testing.T) *sourceLimits {
+	t.Helper()
+	limits, err := newSourceLimits(RunRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &limits
+}
+
+// readTar returns the headers and contents of the entries of the tar r, keyed
+// by name.
+func readTar(t *testing.T, r io.Reader) (map[string]*tar.Header, map[string]string) {
+	t.Helper()
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return headers, contents
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read tar entry %s: %v", header.Name, err)
+		}
+		headers[header.Name] = header
+		contents[header.Name] = string(b)
+	}
+}
+
+func TestTarKeepsNestedPaths(t *testing.T) {
+	files, err := loadSourceFiles("testdata/nested", testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+	content, err := createTarfileOfCode(files, "")
+	if err != nil {
+		t.Fatalf("createTarfileOfCode: %v", err)
+	}
+	defer content.Close()
+
+	_, contents := readTar(t, content)
+	if got := contents["a/b/c.py"]; got != "print(\"nested\")\n" {
+		t.Errorf("a/b/c.py = %q, want the fixture's contents", got)
+	}
+	if _, ok := contents["c.py"]; ok {
+		t.Error("c.py was flattened into the root")
+	}
+	if _, ok := contents["main.py"]; !ok {
+		t.Error("main.py is missing")
+	}
+}
+
+func TestLoadSourceFilesMissingDir(t *testing.T) {
+	files, err := loadSourceFiles("testdata/does-not-exist", testLimits(t), defaultExclude)
+	if err == nil {
+		t.Fatalf("loadSourceFiles returned %d files and no error", len(files))
+	}
+}
+
+func TestRunSourceFiles(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		if string(c.files["main.py"]) != "print('hi')\n" {
+			return fakeExit{code: 1}
+		}
+		return fakeExit{output: []fakeChunk{outChunk("hi\n")}}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "hi\n" {
+		t.Errorf("ExitCode = %d, Stdout = %q, want main.py packed and run", result.ExitCode, result.Stdout)
+	}
+}
+
+func TestRunSourceFilesDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("print('hi')\n")},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "hi\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "hi\n")
+	}
+}
+
+// tarOf returns a tar holding files, keyed by entry name.
+func tarOf(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, contents := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+		})
+		if err == nil {
+			_, err = io.WriteString(tw, contents)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestRunArchive(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	archive := tarOf(t, map[string]string{
+		"main.py":     "import lib.util\n",
+		"lib/util.py": "x = 1\n",
+	})
+	req := fakeRequest()
+	req.SourceFiles = nil
+	if _, err := r.RunArchive(context.Background(), req, archive); err != nil {
+		t.Fatalf("RunArchive: %v", err)
+	}
+
+	c := fc.last()
+	if c.copyDir != codeDir {
+		t.Errorf("extracted to %s, want %s", c.copyDir, codeDir)
+	}
+	for name, want := range map[string]string{
+		"main.py":     "import lib.util\n",
+		"lib/util.py": "x = 1\n",
+	} {
+		if got := string(c.files[name]); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRunArchiveRejectsEscapingPaths(t *testing.T) {
+	for _, name := range []string{"/etc/passwd", "../outside.py", "a/../../outside.py"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		archive := tarOf(t, map[string]string{name: "x"})
+		if _, err := r.RunArchive(context.Background(), fakeRequest(), archive); err == nil {
+			t.Errorf("RunArchive accepted the entry %s", name)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", name, n)
+		}
+	}
+}
+
+// gitArchive returns a tar laid out like git archive writes it: a pax global
+// header holding the commit ID, then the directories and files, each followed
+// by extra if set.
+func gitArchive(t *testing.T, extra ...*tar.Header) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": "5d011a1c61bd5d4c4ac0c0b5ba9d3c07e2e3c3f1"},
+			Format:     tar.FormatPAX,
+		},
+		{Typeflag: tar.TypeDir, Name: "lib/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "lib/util.py", Mode: 0644, Size: 6},
+		{Typeflag: tar.TypeReg, Name: "main.py", Mode: 0644, Size: 16},
+	}
+	contents := map[string]string{"lib/util.py": "x = 1\n", "main.py": "import lib.util\n"}
+	for _, header := range append(headers, extra...) {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, contents[header.Name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestRunArchiveGitArchive(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.SourceFiles = nil
+	if _, err := r.RunArchive(context.Background(), req, gitArchive(t)); err != nil {
+		t.Fatalf("RunArchive: %v", err)
+	}
+	c := fc.last()
+	if _, ok := c.files["pax_global_header"]; ok {
+		t.Error("the global header was extracted as a file")
+	}
+	if got := string(c.files["main.py"]); got != "import lib.util\n" {
+		t.Errorf("main.py = %q, want the archived file", got)
+	}
+
+	// Links and devices are still rejected after a global header.
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeSymlink, Name: "passwd", Linkname: "/etc/passwd"},
+		{Typeflag: tar.TypeLink, Name: "copy.py", Linkname: "main.py"},
+		{Typeflag: tar.TypeChar, Name: "null", Devmajor: 1, Devminor: 3},
+	} {
+		_, err := readTarFiles(gitArchive(t, header), testLimits(t))
+		if err == nil || !strings.Contains(err.Error(), "not a regular file") {
+			t.Errorf("%s: readTarFiles error = %v, want the entry rejected", header.Name, err)
+		}
+	}
+}
+
+func TestLoadSourceFilesRejectsEscapingSymlink(t *testing.T) {
+	_, err := loadSourceFiles("testdata/symlink", testLimits(t), defaultExclude)
+	if err == nil || !strings.Contains(err.Error(), "outside the source root") {
+		t.Errorf("loadSourceFiles error = %v, want the symlink to /etc/passwd rejected", err)
+	}
+}
+
+func TestLoadSourceFilesFollowsInnerSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "util.py"), []byte("x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("util.py", filepath.Join(dir, "main.py")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := loadSourceFiles(dir, testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+	if !hasFile(files, "main.py") {
+		t.Error("main.py, a symlink inside the root, was not loaded")
+	}
+}
+
+func TestRunSourceSizeLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		req   RunRequest
+	}{
+		{
+			name:  "per-file",
+			files: map[string]string{"main.py": strings.Repeat("#", 200)},
+			req:   RunRequest{MaxFileBytes: 100},
+		},
+		{
+			name: "total",
+			files: map[string]string{
+				"main.py": strings.Repeat("#", 100),
+				"util.py": strings.Repeat("#", 100),
+			},
+			req: RunRequest{MaxSourceBytes: 150},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, contents := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := tt.req
+		req.Image = fakeImage
+		req.SourceDir = dir
+		_, err := r.Run(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "limit") {
+			t.Errorf("%s: Run error = %v, want the limit enforced", tt.name, err)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", tt.name, n)
+		}
+	}
+}
+
+// writeLargeFixture writes 20 files of 1MB each to a new directory and returns
+// it.
+func writeLargeFixture(b *testing.B) string {
+	b.Helper()
+	dir := b.TempDir()
+	contents := bytes.Repeat([]byte("x = 1\n"), (1<<20)/6)
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(dir, "file"+strconv.Itoa(i)+".py")
+		if err := os.WriteFile(name, contents, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// BenchmarkPackStreaming packs the large fixture the way runs do, streaming
+// one file at a time into the tar.
+func BenchmarkPackStreaming(b *testing.B) {
+	dir := writeLargeFixture(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		limits, _ := newSourceLimits(RunRequest{MaxSourceBytes: 1 << 30})
+		files, err := loadSourceFiles(dir, &limits, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		content, err := createTarfileOfCode(files, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			b.Fatal(err)
+		}
+		content.Close()
+	}
+}
+
+// BenchmarkPackBuffered packs the large fixture as packing used to, reading
+// every file into memory before writing the tar, for comparison.
+func BenchmarkPackBuffered(b *testing.B) {
+	dir := writeLargeFixture(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		contents := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			var sb strings.Builder
+			f, err := os.Open(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(&sb, f)
+			f.Close()
+			contents[entry.Name()] = sb.String()
+		}
+
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, c := range contents {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0777, Size: int64(len(c))})
+			io.WriteString(tw, c)
+		}
+		tw.Close()
+		io.Copy(io.Discard, &buf)
+	}
+}
+
+func TestTarKeepsModes(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"main.py": 0644, "run.sh": 0755} {
+		pathname := filepath.Join(dir, name)
+		if err := os.WriteFile(pathname, []byte("x"), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(pathname, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := loadSourceFiles(dir, testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+	content, err := createTarfileOfCode(files, "")
+	if err != nil {
+		t.Fatalf("createTarfileOfCode: %v", err)
+	}
+	defer content.Close()
+
+	headers, _ := readTar(t, content)
+	for name, want := range map[string]int64{"main.py": 0644, "run.sh": 0755} {
+		if header, ok := headers[name]; !ok || header.Mode != want {
+			t.Errorf("%s has the header %+v, want mode %o", name, header, want)
+		}
+	}
+	if header, ok := headers["empty/"]; !ok || header.Typeflag != tar.TypeDir {
+		t.Errorf("empty/ has the header %+v, want a directory entry", header)
+	}
+}
+
+func TestRunWithoutTimer(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithTimerScript(""))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	c := fc.last()
+	if _, ok := c.files[timerName]; ok {
+		t.Errorf("%s was packed with the wrapper disabled", timerName)
+	}
+	if cmd := c.config.Cmd; cmd[len(cmd)-2] != "python3" || strings.Contains(strings.Join(cmd, " "), timerName) {
+		t.Errorf("Cmd = %q, want python3 run directly", cmd)
+	}
+}
+
+func TestRunCustomTimer(t *testing.T) {
+	wrapper := filepath.Join(t.TempDir(), "wrapper.sh")
+	if err := os.WriteFile(wrapper, []byte("#!/bin/sh\nexec \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithTimerScript(wrapper))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := string(fc.last().files[timerName]); got != "#!/bin/sh\nexec \"$@\"\n" {
+		t.Errorf("%s = %q, want the custom wrapper", timerName, got)
+	}
+}
+
+func TestRunTimerRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		timer string
+		files map[string][]byte
+		want  string
+	}{
+		{name: "missing", timer: "testdata/no-such-timer.sh", want: "timer script"},
+		{name: "directory", timer: "testdata", want: "not a regular file"},
+		{name: "collision", timer: testTimerScript, files: map[string][]byte{timerName: []byte("")}, want: "reserved"},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc, WithTimerScript(tt.timer))
+
+		req := fakeRequest()
+		for name, contents := range tt.files {
+			req.SourceFiles[name] = contents
+		}
+		_, err := r.Run(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Run error = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", tt.name, n)
+		}
+	}
+}
+
+func TestTarHeadersAreConsistent(t *testing.T) {
+	files, err := loadSourceFiles("testdata/nested", testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+	files = append(files, memorySourceFiles(map[string][]byte{"input.txt": []byte("1 2\n")})...)
+	content, err := createTarfileOfCode(files, testTimerScript)
+	if err != nil {
+		t.Fatalf("createTarfileOfCode: %v", err)
+	}
+	defer content.Close()
+
+	// Every entry, the wrapper included, gets a header of the same shape,
+	// taken from the file it was packed from.
+	want := map[string]string{
+		timerName:   testTimerScript,
+		"main.py":   "testdata/nested/main.py",
+		"a/":        "testdata/nested/a",
+		"a/b/":      "testdata/nested/a/b",
+		"a/b/c.py":  "testdata/nested/a/b/c.py",
+		"input.txt": "",
+	}
+	headers, _ := readTar(t, content)
+	if len(headers) != len(want) {
+		t.Errorf("packed %d entries, want %d", len(headers), len(want))
+	}
+	for name, pathname := range want {
+		header, ok := headers[name]
+		if !ok {
+			t.Errorf("%s is missing", name)
+			continue
+		}
+		mode, size, typeflag := int64(memoryFileMode), int64(4), byte(tar.TypeReg)
+		if pathname != "" {
+			info, err := os.Stat(pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mode, size = int64(info.Mode().Perm()), info.Size()
+			if info.IsDir() {
+				size, typeflag = 0, tar.TypeDir
+			}
+		}
+		if header.Typeflag != typeflag || header.Mode != mode || header.Size != size || header.Uid != 0 || header.Uname != "" {
+			t.Errorf("%s has the header %+v, want type %c, mode %o, size %d and no owner", name, header, typeflag, mode, size)
+		}
+	}
+}
+
+// captureStdout redirects os.Stdout to a pipe for the rest of the test and
+// returns a function closing it and returning what was written.
+func captureStdout(t *testing.T) func() string {
+	t.Helper()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = pw
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(pr)
+		pr.Close()
+		output <- string(b)
+	}()
+	return func() string {
+		os.Stdout = stdout
+		pw.Close()
+		return <-output
+	}
+}
+
+func TestRunDumpsNoSource(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var debug bytes.Buffer
+		output, wasEnabled := util.DebugOutput, util.DebugEnabled
+		util.DebugOutput, util.DebugEnabled = &debug, enabled
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		stdout := captureStdout(t)
+		_, err := r.Run(context.Background(), fakeRequest())
+		got := stdout()
+		util.DebugOutput, util.DebugEnabled = output, wasEnabled
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if got != "" {
+			t.Errorf("debug %t: the run printed %q to stdout", enabled, got)
+		}
+		if strings.Contains(debug.String(), "print('hi')") || (debug.Len() > 0) != enabled {
+			t.Errorf("debug %t: debug output = %q, want only the file names when enabled", enabled, debug.String())
+		}
+	}
+}
+
+func TestRunArchiveTempDir(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, err := zw.Create("main.py")
+	if err == nil {
+		_, err = io.WriteString(w, "print('hi')\n")
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := t.TempDir()
+	fc := newFakeClient(t)
+	var during []string
+	fc.program = func(c *fakeContainer) fakeExit {
+		during, _ = filepath.Glob(filepath.Join(base, "runner-*"))
+		return fakeExit{}
+	}
+	r := newTestRunner(fc, WithTempDir(base))
+
+	for _, tt := range []struct {
+		archive io.Reader
+		fails   bool
+	}{
+		{archive: &zipped},
+		{archive: strings.NewReader("PK\x03\x04 not a zip"), fails: true},
+	} {
+		during = nil
+		_, err := r.RunArchive(context.Background(), fakeRequest(), tt.archive)
+		if fails := err != nil; fails != tt.fails {
+			t.Fatalf("RunArchive error = %v, want failing %t", err, tt.fails)
+		}
+		if !tt.fails && len(during) != 1 {
+			t.Errorf("found %v during the run, want one scratch directory below %s", during, base)
+		}
+		entries, readErr := os.ReadDir(base)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if len(entries) != 0 {
+			t.Errorf("run error %v: %d entries are left below %s", err, len(entries), base)
+		}
+	}
+}
+
+// zeros is an endless stream of zero bytes.
+type zeros struct{ read int64 }
+
+func (z *zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	z.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestRunArchiveBoundsZipSpool(t *testing.T) {
+	base := t.TempDir()
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithTempDir(base))
+
+	// A zip upload that never ends.
+	endless := &zeros{}
+	req := fakeRequest()
+	req.MaxSourceBytes = 1 << 20
+	_, err := r.RunArchive(context.Background(), req, io.MultiReader(strings.NewReader("PK\x03\x04"), endless))
+	if !errors.Is(err, ErrSourceTooLarge) {
+		t.Fatalf("RunArchive error = %v, want ErrSourceTooLarge", err)
+	}
+	if endless.read > 2<<20 {
+		t.Errorf("read %d bytes of the upload, want it cut off at the 1 MiB limit", endless.read)
+	}
+	if entries, err := os.ReadDir(base); err != nil || len(entries) != 0 {
+		t.Errorf("left %d entries below %s: %v", len(entries), base, err)
+	}
+}
+
+func TestTarKeepsBinaryContents(t *testing.T) {
+	// Invalid UTF-8, NUL bytes and every other byte value.
+	blob := make([]byte, 512)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	blob = append(blob, 0xff, 0xfe, 0x00, 0xc3, 0x28)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fixture.bin"), blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fromDisk, err := loadSourceFiles(dir, testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+
+	for _, files := range [][]sourceFile{fromDisk, memorySourceFiles(map[string][]byte{"fixture.bin": blob})} {
+		content, err := createTarfileOfCode(files, "")
+		if err != nil {
+			t.Fatalf("createTarfileOfCode: %v", err)
+		}
+		_, contents := readTar(t, content)
+		content.Close()
+		if got := contents["fixture.bin"]; !bytes.Equal([]byte(got), blob) {
+			t.Errorf("fixture.bin holds %d bytes differing from the %d packed", len(got), len(blob))
+		}
+	}
+}
+
+func TestRunArchiveFromPipe(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk(string(c.files["lib/greeting.txt"]))}}
+	}
+	r := newTestRunner(fc)
+
+	// The archive arrives gzip-compressed through a pipe, as from tar czf -.
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, tarOf(t, map[string]string{
+			"main.py":          "print(open('lib/greeting.txt').read(), end='')\n",
+			"lib/greeting.txt": "from the pipe\n",
+		}))
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	req := fakeRequest()
+	req.SourceFiles = nil
+	result, err := r.RunArchive(context.Background(), req, pr)
+	if err != nil {
+		t.Fatalf("RunArchive: %v", err)
+	}
+	if result.Stdout != "from the pipe\n" {
+		t.Errorf("Stdout = %q, want the archived files run", result.Stdout)
+	}
+	if _, ok := fc.last().files[timerName]; !ok {
+		t.Errorf("%s was not packed along with the archive", timerName)
+	}
+}
+
+func TestRunMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 12; i++ {
+		name := "file" + strconv.Itoa(i) + ".py"
+		files[name] = "x = 1\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x = 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory := make(map[string][]byte)
+	for name, contents := range files {
+		memory[name] = []byte(contents)
+	}
+
+	for _, tt := range []struct {
+		name string
+		run  func(r *Runner, req RunRequest) error
+	}{
+		{name: "source dir", run: func(r *Runner, req RunRequest) error {
+			req.SourceDir = dir
+			_, err := r.Run(context.Background(), req)
+			return err
+		}},
+		{name: "source files", run: func(r *Runner, req RunRequest) error {
+			req.SourceFiles = memory
+			_, err := r.Run(context.Background(), req)
+			return err
+		}},
+		{name: "archive", run: func(r *Runner, req RunRequest) error {
+			_, err := r.RunArchive(context.Background(), req, tarOf(t, files))
+			return err
+		}},
+	} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		err := tt.run(r, RunRequest{Image: fakeImage, EntryFile: "file0.py", MaxFiles: 10})
+		if err == nil || !strings.Contains(err.Error(), "limit of 10 files") {
+			t.Errorf("%s: Run error = %v, want the file limit enforced", tt.name, err)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", tt.name, n)
+		}
+	}
+}
+
+func TestRunExclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		want    []string
+	}{
+		{name: "default", want: []string{"main.py", "notes/draft.md", "venv/lib/site.py"}},
+		{name: "custom", exclude: []string{"venv", "*.md"}, want: []string{"__pycache__/main.cpython-310.pyc", "main.py"}},
+		{name: "none", exclude: []string{}, want: []string{"__pycache__/main.cpython-310.pyc", "main.py", "notes/draft.md", "venv/lib/site.py"}},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc, WithTimerScript(""))
+
+		_, err := r.Run(context.Background(), RunRequest{
+			Image:     fakeImage,
+			SourceDir: "testdata/excluded",
+			Exclude:   tt.exclude,
+		})
+		if err != nil {
+			t.Fatalf("%s: Run: %v", tt.name, err)
+		}
+		var got []string
+		for name, header := range fc.last().headers {
+			if header.Typeflag == tar.TypeReg {
+				got = append(got, name)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: packed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSourceFilesSkipsGit(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"main.py": "", ".git/HEAD": "ref: refs/heads/main\n"} {
+		pathname := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := loadSourceFiles(dir, testLimits(t), defaultExclude)
+	if err != nil {
+		t.Fatalf("loadSourceFiles: %v", err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name, ".git") {
+			t.Errorf("%s was loaded", file.Name)
+		}
+	}
+}
+
+func TestRunExtraFiles(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.images[0].RepoTags = append(fc.images[0].RepoTags, "node:20-alpine")
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk(string(c.files["input.txt"]))}}
+	}
+	r := newTestRunner(fc)
+
+	input := strings.Repeat("1 2\n", 64)
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.js": []byte("console.log('hi')\n")},
+		ExtraFiles: map[string][]byte{
+			"input.txt":      []byte(input),
+			"grader/a.py":    nil,
+			"grader/b.py":    nil,
+			"tests/check.py": nil,
+		},
+		// The extra files are over both limits.
+		MaxFileBytes: 32,
+		MaxFiles:     2,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != input {
+		t.Errorf("Stdout = %q, want the contents of input.txt", result.Stdout)
+	}
+	if result.Language != "node" {
+		t.Errorf("Language = %q, want node detected from the submission only", result.Language)
+	}
+	for _, name := range []string{"main.js", "input.txt", "grader/a.py", "timer.sh"} {
+		if _, ok := fc.last().files[name]; !ok {
+			t.Errorf("%s was not packed", name)
+		}
+	}
+}
+
+func TestRunExtraFilesRejects(t *testing.T) {
+	for _, name := range []string{"main.py", "./main.py", "../input.txt", "/code/input.txt", "timer.sh", "."} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.ExtraFiles = map[string][]byte{name: []byte("1 2\n")}
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted the extra file %s", name)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", name, n)
+		}
+	}
+}
+
+func TestRunExtraFilesDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("a, b = map(int, open('input.txt').read().split())\nprint(a + b)\n"),
+		},
+		ExtraFiles: map[string][]byte{"input.txt": []byte("1 2\n")},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "3\n" {
+		t.Errorf("Stdout = %q, Stderr = %q, want 3", result.Stdout, result.Stderr)
+	}
+}
@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// IndexedResult is the outcome of one request of a batch passed to RunStream.
+type IndexedResult struct {
+	// Index is the position of the request in the batch.
+	Index int
+
+	Result RunResult
+	Err    error
+}
+
+// BatchRun runs reqs with at most concurrency of them in flight and returns
+// their results in input order. A failing run does not stop the others: its
+// result is left zero and the returned error joins the errors of all failed
+// runs, each naming the index of its request.
+func (r *Runner) BatchRun(ctx context.Context, reqs []RunRequest, concurrency int) ([]RunResult, error) {
+	var (
+		results = make([]RunResult, len(reqs))
+		errs    = make([]error, len(reqs))
+	)
+	for res := range r.RunStream(ctx, reqs, concurrency) {
+		if res.Err != nil {
+			errs[res.Index] = fmt.Errorf("run %d: %w", res.Index, res.Err)
+			continue
+		}
+		results[res.Index] = res.Result
+	}
+	return results, errors.Join(errs...)
+}
+
+// RunStream runs reqs like BatchRun, but delivers every result on the returned
+// channel as soon as its run is over, e.g. to report progress. Each index is
+// delivered exactly once, failed runs included, and the channel is closed
+// after the last one. The channel is buffered for the whole batch, so runs
+// never wait for the caller to receive.
+func (r *Runner) RunStream(ctx context.Context, reqs []RunRequest, concurrency int) <-chan IndexedResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make(chan IndexedResult, len(reqs))
+	go func() {
+		var (
+			sem = make(chan struct{}, concurrency)
+			wg  sync.WaitGroup
+		)
+		for i, req := range reqs {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, req RunRequest) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				result, err := r.Run(ctx, req)
+				results <- IndexedResult{
+					Index:  i,
+					Result: result,
+					Err:    err,
+				}
+			}(i, req)
+		}
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCat is a program printing its main.py, taking longer the smaller the
+// number it holds, so that batches finish out of order.
+func fakeCat(c *fakeContainer) fakeExit {
+	contents := string(c.files["main.py"])
+	n, _ := strconv.Atoi(contents)
+	return fakeExit{output: []fakeChunk{{
+		data:  contents + "\n",
+		delay: time.Duration(10-n) * time.Millisecond,
+	}}}
+}
+
+// numberedRequests returns n requests whose main.py holds their index.
+func numberedRequests(n int) []RunRequest {
+	reqs := make([]RunRequest, n)
+	for i := range reqs {
+		reqs[i] = RunRequest{
+			Image:       fakeImage,
+			SourceFiles: map[string][]byte{"main.py": []byte(strconv.Itoa(i))},
+		}
+	}
+	return reqs
+}
+
+func TestBatchRunKeepsInputOrder(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = fakeCat
+	r := newTestRunner(fc)
+
+	reqs := numberedRequests(8)
+	reqs[5].Language = "cobol"
+	results, err := r.BatchRun(context.Background(), reqs, 3)
+	if err == nil || !strings.Contains(err.Error(), "5") {
+		t.Errorf("BatchRun error = %v, want the failure of request 5", err)
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("got %d results for %d requests", len(results), len(reqs))
+	}
+	for i, result := range results {
+		want := strconv.Itoa(i) + "\n"
+		if i == 5 {
+			want = ""
+		}
+		if result.Stdout != want {
+			t.Errorf("result %d has Stdout %q, want %q", i, result.Stdout, want)
+		}
+	}
+}
+
+func TestRunStreamDeliversEachIndexOnce(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = fakeCat
+	r := newTestRunner(fc)
+
+	reqs := numberedRequests(10)
+	failing := map[int]bool{2: true, 7: true}
+	for i := range failing {
+		reqs[i].Language = "cobol"
+	}
+
+	seen := make(map[int]int)
+	for res := range r.RunStream(context.Background(), reqs, 4) {
+		seen[res.Index]++
+		if failing[res.Index] != (res.Err != nil) {
+			t.Errorf("result %d: Err = %v, want a failure %t", res.Index, res.Err, failing[res.Index])
+		}
+		if want := strconv.Itoa(res.Index) + "\n"; res.Err == nil && res.Result.Stdout != want {
+			t.Errorf("result %d has Stdout %q, want %q", res.Index, res.Result.Stdout, want)
+		}
+	}
+	for i := range reqs {
+		if seen[i] != 1 {
+			t.Errorf("index %d delivered %d times, want once", i, seen[i])
+		}
+	}
+	if len(seen) != len(reqs) {
+		t.Errorf("got %d indices for %d requests", len(seen), len(reqs))
+	}
+}
@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types/blkiodev"
+)
+
+// validateBlkioWeight checks that weight is unset or within the range the
+// kernel accepts.
+func validateBlkioWeight(weight uint16) error {
+	if weight != 0 && (weight < 10 || weight > 1000) {
+		return fmt.Errorf("block IO weight of %d is outside of 10 to 1000", weight)
+	}
+	return nil
+}
+
+// throttleDevices turns limits, mapping device paths to bytes per second, into
+// throttle devices sorted by path.
+func throttleDevices(limits map[string]uint64) []*blkiodev.ThrottleDevice {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	devices := make([]*blkiodev.ThrottleDevice, 0, len(limits))
+	for path, rate := range limits {
+		devices = append(devices, &blkiodev.ThrottleDevice{
+			Path: path,
+			Rate: rate,
+		})
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Path < devices[j].Path
+	})
+	return devices
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"strings"
+)
+
+// Lines the compile wrapper writes to stderr once the compile command has
+// finished, separating the compiler's output from the program's.
+const (
+	compiledMarker      = "__RUNNER_COMPILED__"
+	compileFailedMarker = "__RUNNER_COMPILE_FAILED__"
+)
+
+// compileScript runs the compile command given as its script, with all of its
+// output on stderr, and then executes its arguments unless compiling failed.
+const compileScript = `{ %s; } 1>&2 || {
+	status=$?
+	echo "` + compileFailedMarker + `" >&2
+	exit $status
+}
+echo "` + compiledMarker + `" >&2
+exec "$@"`
+
+// compileCmd returns a command that runs compile and then, if it succeeds,
+// run. compile is quoted for the shell, so its arguments are never
+// interpreted.
+func compileCmd(compile, run []string) []string {
+	quoted := make([]string, len(compile))
+	for i, arg := range compile {
+		quoted[i] = shellQuote(arg)
+	}
+	script := strings.Replace(compileScript, "%s", strings.Join(quoted, " "), 1)
+	return append([]string{"sh", "-c", script, "sh"}, run...)
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// extractCompile splits the compiler's output, written before the first line
+// holding one of the compile markers, from output. It returns the remaining
+// output, the compiler's output and whether compiling failed. Output without a
+// marker line is returned unchanged.
+func extractCompile(output string) (string, string, bool) {
+	for start := 0; start < len(output); {
+		end := strings.IndexByte(output[start:], '\n')
+		if end < 0 {
+			end = len(output)
+		} else {
+			end += start
+		}
+
+		switch strings.TrimSuffix(output[start:end], "\r") {
+		case compiledMarker:
+			return strings.TrimPrefix(output[end:], "\n"), output[:start], false
+		case compileFailedMarker:
+			return strings.TrimPrefix(output[end:], "\n"), output[:start], true
+		}
+		start = end + 1
+	}
+	return output, "", false
+}
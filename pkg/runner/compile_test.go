@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// brokenC is the compiler error for testdata/broken-c.
+const brokenC = "main.c: In function 'main':\nmain.c:4:24: error: expected ';' before 'return'\n"
+
+func TestRunCompileFailed(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.images[0].RepoTags = append(fc.images[0].RepoTags, "gcc:13")
+	fc.program = func(c *fakeContainer) fakeExit {
+		// What the compile wrapper prints when gcc fails, never running the
+		// program.
+		return fakeExit{output: []fakeChunk{errChunk(brokenC + compileFailedMarker + "\n")}, code: 1}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		Language:  "c",
+		SourceDir: "testdata/broken-c",
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.CompileFailed || result.CompileStderr != brokenC {
+		t.Errorf("CompileFailed = %t, CompileStderr = %q, want the compiler error", result.CompileFailed, result.CompileStderr)
+	}
+	if result.Stdout != "" || result.Stderr != "" {
+		t.Errorf("Stdout = %q, Stderr = %q, want no output of the program", result.Stdout, result.Stderr)
+	}
+	want := Diagnostic{File: "main.c", Line: 4, Column: 24, Message: "expected ';' before 'return'"}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0] != want {
+		t.Errorf("Diagnostics = %+v, want %+v", result.Diagnostics, want)
+	}
+
+	cmd := strings.Join(fc.last().config.Cmd, " ")
+	if !strings.Contains(cmd, "'gcc' '-O2' '-o' 'main' 'main.c' '-lm'") || !strings.HasSuffix(cmd, `exec "$@" sh sh ./timer.sh ./main`) {
+		t.Errorf("Cmd = %q, want gcc run before timing ./main", cmd)
+	}
+}
+
+func TestRunCompileAllFiles(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.images[0].RepoTags = append(fc.images[0].RepoTags, "gcc:13")
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{errChunk(compiledMarker + "\n"), outChunk("3\n")}}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		Language:  "c",
+		SourceDir: "testdata/multi-c",
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.CompileFailed || result.Stdout != "3\n" {
+		t.Errorf("CompileFailed = %t, Stdout = %q, want the program to run", result.CompileFailed, result.Stdout)
+	}
+
+	// Both sources reach gcc, the header does not.
+	cmd := strings.Join(fc.last().config.Cmd, " ")
+	if !strings.Contains(cmd, "'gcc' '-O2' '-o' 'main' 'add.c' 'main.c' '-lm'") || strings.Contains(cmd, "add.h") {
+		t.Errorf("Cmd = %q, want add.c and main.c compiled", cmd)
+	}
+}
+
+func TestExtractCompile(t *testing.T) {
+	tests := []struct {
+		output, rest, compile string
+		failed                bool
+	}{
+		{output: "warning\n" + compiledMarker + "\nran\n", rest: "ran\n", compile: "warning\n"},
+		{output: "error\n" + compileFailedMarker + "\n", compile: "error\n", failed: true},
+		{output: "no marker\n", rest: "no marker\n"},
+	}
+	for _, tt := range tests {
+		rest, compile, failed := extractCompile(tt.output)
+		if rest != tt.rest || compile != tt.compile || failed != tt.failed {
+			t.Errorf("extractCompile(%q) = %q, %q, %t, want %q, %q, %t", tt.output, rest, compile, failed, tt.rest, tt.compile, tt.failed)
+		}
+	}
+}
+
+func TestRunCompileFailedDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		Language:  "c",
+		SourceDir: "testdata/broken-c",
+	})
+	if errors.Is(err, ErrImageNotFound) {
+		t.Skip("needs the gcc:13 image")
+	}
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.CompileFailed || !strings.Contains(result.CompileStderr, "expected ';'") {
+		t.Errorf("CompileFailed = %t, CompileStderr = %q, want the compiler error", result.CompileFailed, result.CompileStderr)
+	}
+	if strings.Contains(result.Stdout, "ran") {
+		t.Errorf("Stdout = %q, want the program not to run", result.Stdout)
+	}
+}
+
+func TestRunCompileAllFilesDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		Language:  "c",
+		SourceDir: "testdata/multi-c",
+	})
+	if errors.Is(err, ErrImageNotFound) {
+		t.Skip("needs the gcc:13 image")
+	}
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.CompileFailed || result.Stdout != "3\n" {
+		t.Errorf("CompileFailed = %t, CompileStderr = %q, Stdout = %q, want 3", result.CompileFailed, result.CompileStderr, result.Stdout)
+	}
+}
@@ -0,0 +1,417 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Labels set on every container the runner creates.
+const (
+	labelCreatedBy = "created-by"
+	createdBy      = "mtstnt-runner"
+
+	// labelRequestID carries RunRequest.RequestID.
+	labelRequestID = "mtstnt-runner.request-id"
+)
+
+// containerLabels returns the labels of a container created for the run
+// identified by requestID, which may be empty.
+func containerLabels(requestID string) map[string]string {
+	labels := map[string]string{
+		labelCreatedBy: createdBy,
+	}
+	if requestID != "" {
+		labels[labelRequestID] = requestID
+	}
+	return labels
+}
+
+// readyPollInterval is how often waitRunning inspects a container.
+const readyPollInterval = 50 * time.Millisecond
+
+// readyMarker is created once the submission has been extracted into a
+// running container, releasing the program held back by gateCmd.
+const readyMarker = "/tmp/.runner-ready"
+
+// disposeContainer force-removes the container along with its anonymous
+// volumes, stopping it first if it is still running.
+func disposeContainer(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+) error {
+	return dc.ContainerRemove(
+		ctx,
+		containerID,
+		types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			Force:         true,
+		},
+	)
+}
+
+// codeMount backs the working directory dir with an anonymous volume, keeping
+// it writable when the root filesystem is read-only but output files are to
+// be collected, which a tmpfs would not survive. A new volume copies the
+// ownership of dir in the image, so the image should hand dir to the user the
+// program runs as. The volume is removed along with the container.
+func codeMount(dir string) mount.Mount {
+	return mount.Mount{
+		Type:   mount.TypeVolume,
+		Target: dir,
+	}
+}
+
+// containerName returns a unique name for a new container, so that runs on the
+// same daemon never conflict.
+func containerName() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Leave naming to the daemon, which picks a unique name itself.
+		return ""
+	}
+	return "runner-" + hex.EncodeToString(b)
+}
+
+// newRequestID returns a random ID for a run that was not given one.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// createContainer creates a container for config and hostConfig, or takes a
+// matching one from the pool, and tracks it.
+func (r *Runner) createContainer(
+	ctx context.Context,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+) (string, error) {
+	if r.pool != nil {
+		return r.pool.take(ctx, r, config, hostConfig)
+	}
+	return r.newContainer(ctx, config, hostConfig)
+}
+
+// newContainer creates a container for config and hostConfig and tracks it.
+func (r *Runner) newContainer(
+	ctx context.Context,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+) (string, error) {
+	createResp, err := r.dc.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		&network.NetworkingConfig{},
+		&v1.Platform{},
+		containerName(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	r.track(createResp.ID)
+	return createResp.ID, nil
+}
+
+// track records containerID as created by r until it is disposed.
+func (r *Runner) track(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.live[containerID] = struct{}{}
+}
+
+// untrack stops tracking containerID, leaving the container in place.
+func (r *Runner) untrack(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.live, containerID)
+}
+
+// dispose removes the container and stops tracking it.
+func (r *Runner) dispose(ctx context.Context, containerID string) error {
+	if err := disposeContainer(ctx, r.dc, containerID); err != nil {
+		return err
+	}
+	r.untrack(containerID)
+	return nil
+}
+
+// disposeAll removes the containers in the background of a run, giving up
+// after finishTimeout. Failures are left to Shutdown or Cleanup.
+func (r *Runner) disposeAll(containerIDs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	for _, id := range containerIDs {
+		r.dispose(ctx, id)
+	}
+}
+
+// Shutdown removes every container created by r that has not been disposed
+// yet, e.g. because a run was interrupted by a cancelled context, including
+// idle pooled containers. ctx should not be the cancelled run context itself.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	if r.pool != nil {
+		r.pool.drain()
+	}
+
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.live))
+	for id := range r.live {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		if err := r.dispose(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cleanup removes every container on the daemon that carries the runner's
+// created-by label, whether it was created by r, by another Runner or by an
+// earlier process that never got to remove it. Containers of runs still in
+// progress elsewhere are removed too, so Cleanup is meant for when no other
+// runner shares the daemon, e.g. at startup.
+func (r *Runner) Cleanup(ctx context.Context) error {
+	containers, err := r.dc.ContainerList(
+		ctx,
+		types.ContainerListOptions{
+			All: true,
+			Filters: filters.NewArgs(
+				filters.Arg("label", labelCreatedBy+"="+createdBy),
+			),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range containers {
+		if err := r.dispose(ctx, c.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close removes the containers left by r, as Shutdown does, and closes the
+// Docker client. Long-lived users of a Runner should defer it; r must not be
+// used afterwards. Calling Close again does nothing and returns the first
+// result.
+func (r *Runner) Close() error {
+	r.closeOnce.Do(func() {
+		r.closeErr = errors.Join(
+			r.Shutdown(context.Background()),
+			r.dc.Close(),
+		)
+	})
+	return r.closeErr
+}
+
+// stopContainer sends SIGTERM to the container, kills it once grace has passed
+// and blocks until it has stopped. A zero grace kills it immediately.
+func stopContainer(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	grace time.Duration,
+) error {
+	timeout := int((grace + time.Second - 1) / time.Second)
+	return dc.ContainerStop(
+		ctx,
+		containerID,
+		container.StopOptions{
+			Timeout: &timeout,
+		},
+	)
+}
+
+// exitStatus returns the exit code of the container and true if it has exited
+// already. It does not take a context, as it is used once the run's context is
+// cancelled, and gives up after finishTimeout.
+func exitStatus(dc DockerClient, containerID string) (int, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+
+	info, err := dc.ContainerInspect(ctx, containerID)
+	if err != nil || info.State == nil || info.State.Status != "exited" {
+		return 0, false
+	}
+	return info.State.ExitCode, true
+}
+
+// startError returns the error the daemon recorded in the container's state,
+// such as an "exec format error" of a command that could not be executed, or
+// an empty string if there is none or the container could not be inspected.
+func startError(ctx context.Context, dc DockerClient, containerID string) string {
+	info, err := dc.ContainerInspect(ctx, containerID)
+	if err != nil || info.State == nil {
+		return ""
+	}
+	return info.State.Error
+}
+
+// waitRunning polls the container until it is running, for a container that is
+// started before the submission is copied into it. It fails with ErrNotReady
+// once timeout expires, and returns early when the container exits instead.
+func waitRunning(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	timeout time.Duration,
+) error {
+	readyCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := dc.ContainerInspect(readyCtx, containerID)
+		if err != nil && readyCtx.Err() == nil {
+			return err
+		}
+		if err == nil && info.State != nil {
+			switch {
+			case info.State.Running:
+				return nil
+			case info.State.Status == "exited" || info.State.Status == "dead":
+				return fmt.Errorf("%w: container %s", ErrNotReady, info.State.Status)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-readyCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: not running after %s", ErrNotReady, timeout)
+		}
+	}
+}
+
+// codeTmpfs returns the options of the tmpfs of size bytes backing the
+// working directory when the root filesystem is read-only. Unlike /tmp, it
+// allows executing files, e.g. a compiled program.
+func codeTmpfs(size int64) string {
+	return fmt.Sprintf("size=%d,exec", size)
+}
+
+// gateCmd wraps cmd so that it only runs once readyMarker exists, for a
+// container that is started before the submission is copied into it.
+func gateCmd(cmd []string) []string {
+	gate := `while [ ! -e ` + readyMarker + ` ]; do sleep 0.05; done; exec "$@"`
+	return append([]string{"sh", "-c", gate, "sh"}, cmd...)
+}
+
+// extractCode unpacks the tar content into dir of the running container by
+// running tar in it as user, then creates readyMarker. CopyToContainer works
+// on the container's filesystem as seen from the host, which does not include
+// a tmpfs mounted at dir.
+func extractCode(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	user string,
+	dir string,
+	content io.Reader,
+) error {
+	exec, err := dc.ContainerExecCreate(
+		ctx,
+		containerID,
+		types.ExecConfig{
+			User:         user,
+			AttachStdin:  true,
+			AttachStdout: true,
+			AttachStderr: true,
+			Cmd:          []string{"sh", "-c", `tar -x -f - -C "$1" && : >"$2"`, "sh", dir, readyMarker},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("extract submission: %w", err)
+	}
+	hr, err := dc.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return fmt.Errorf("extract submission: %w", err)
+	}
+	defer hr.Close()
+
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(hr.Conn, content)
+		hr.CloseWrite()
+		copied <- err
+	}()
+
+	// tar explains a failure, e.g. running out of space, on its output.
+	var output bytes.Buffer
+	_, err = stdcopy.StdCopy(&output, &output, hr.Reader)
+	hr.Close()
+	copyErr := <-copied
+	if err != nil {
+		return fmt.Errorf("extract submission: %w", err)
+	}
+
+	info, err := dc.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return fmt.Errorf("extract submission: %w", err)
+	}
+	if info.ExitCode != 0 {
+		err := fmt.Errorf("extract submission: tar exited with status %d: %s", info.ExitCode, strings.TrimSpace(output.String()))
+		return errors.Join(err, copyErr)
+	}
+	return nil
+}
+
+// attachStdin attaches to the container's standard input and streams stdin
+// into it in the background, closing the input once stdin is exhausted. The
+// copy is abandoned when the program exits without reading everything, so the
+// returned connection must be closed once the container has stopped.
+func attachStdin(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	stdin io.Reader,
+) (types.HijackedResponse, error) {
+	hr, err := dc.ContainerAttach(
+		ctx,
+		containerID,
+		types.ContainerAttachOptions{
+			Stream: true,
+			Stdin:  true,
+		},
+	)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	go func() {
+		io.Copy(hr.Conn, stdin)
+		hr.CloseWrite()
+	}()
+
+	return hr, nil
+}
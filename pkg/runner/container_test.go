@@ -0,0 +1,389 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestRunSurfacesRemoveError(t *testing.T) {
+	fc := newFakeClient(t)
+	removeErr := errors.New("remove failed")
+	fc.removeErrs = []error{removeErr}
+	r := newTestRunner(fc)
+
+	_, err := r.Run(context.Background(), fakeRequest())
+	if !errors.Is(err, removeErr) {
+		t.Errorf("Run error = %v, want the ContainerRemove error", err)
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		n, err := strconv.Atoi(strings.TrimSpace(c.stdin.String()))
+		if err != nil {
+			return fakeExit{output: []fakeChunk{errChunk(err.Error())}, code: 1}
+		}
+		return fakeExit{output: []fakeChunk{outChunk(strconv.Itoa(n*2) + "\n")}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Stdin = strings.NewReader("5\n")
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "10\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "10\n")
+	}
+}
+
+func TestRunStdinDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	for _, source := range []string{
+		"print(int(input()) * 2)\n",
+		// A program that never reads its input must not block.
+		"print(10)\n",
+	} {
+		result, err := r.Run(context.Background(), RunRequest{
+			SourceFiles: map[string][]byte{"main.py": []byte(source)},
+			Stdin:       strings.NewReader("5\n"),
+		})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if result.Stdout != "10\n" {
+			t.Errorf("Stdout of %q = %q, want %q", source, result.Stdout, "10\n")
+		}
+	}
+}
+
+// cancelWriter cancels a context once it is written to.
+type cancelWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestRunCancelRemovesContainer(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk("started\n")}, hang: true}
+	}
+	r := newTestRunner(fc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := fakeRequest()
+	req.Stdout = cancelWriter{cancel}
+	if _, err := r.Run(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run error = %v, want context.Canceled", err)
+	}
+
+	id := fc.last().id
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.removes) != 1 || fc.removes[0] != id {
+		t.Errorf("removed %v, want the container %s", fc.removes, id)
+	}
+}
+
+func TestRunUniqueContainerNames(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit { return fakeExit{hang: true} }
+	r := newTestRunner(fc)
+
+	// The first run keeps its container while the second one runs.
+	req := fakeRequest()
+	req.Timeout = 50 * time.Millisecond
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := r.Run(context.Background(), req)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.created) != 2 {
+		t.Fatalf("created %d containers, want 2", len(fc.created))
+	}
+	a, b := fc.created[0].name, fc.created[1].name
+	if a == b || !strings.HasPrefix(a, "runner-") || !strings.HasPrefix(b, "runner-") {
+		t.Errorf("containers are named %q and %q, want distinct runner- names", a, b)
+	}
+}
+
+func TestRunRetriesNameConflict(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.createErrs = []error{errdefs.Conflict(errors.New("name is already in use"))}
+	r := newTestRunner(fc)
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := fc.called("ContainerCreate"); n != 2 {
+		t.Errorf("ContainerCreate called %d times, want 2", n)
+	}
+}
+
+func TestRunKeepOnFailure(t *testing.T) {
+	tests := []struct {
+		code    int
+		removed bool
+	}{
+		{code: 1, removed: false},
+		{code: 0, removed: true},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		fc.program = func(c *fakeContainer) fakeExit { return fakeExit{code: tt.code} }
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.KeepOnFailure = true
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("exit %d: Run: %v", tt.code, err)
+		}
+		if removed := fc.called("ContainerRemove") > 0; removed != tt.removed {
+			t.Errorf("exit %d: removed = %t, want %t", tt.code, removed, tt.removed)
+		}
+	}
+}
+
+func TestRunWaitError(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{waitError: "container vanished"}
+	}
+	r := newTestRunner(fc)
+
+	_, err := r.Run(context.Background(), fakeRequest())
+	if err == nil || !strings.Contains(err.Error(), "container vanished") {
+		t.Errorf("Run error = %v, want the wait error", err)
+	}
+}
+
+func TestRunLabelsContainer(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.RequestID = "req-1"
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	labels := fc.last().config.Labels
+	if labels[labelCreatedBy] != createdBy || labels[labelRequestID] != "req-1" {
+		t.Errorf("labels = %v, want created-by=%s and the request ID", labels, createdBy)
+	}
+}
+
+func TestCleanupRemovesLabeledContainers(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.listed = []types.Container{
+		{ID: "orphan-1", Labels: map[string]string{labelCreatedBy: createdBy}},
+		{ID: "orphan-2", Labels: map[string]string{labelCreatedBy: createdBy, labelRequestID: "old"}},
+		{ID: "unrelated", Labels: map[string]string{"created-by": "someone-else"}},
+	}
+	r := newTestRunner(fc)
+
+	if err := r.Cleanup(context.Background()); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if want := []string{"orphan-1", "orphan-2"}; !reflect.DeepEqual(fc.removes, want) {
+		t.Errorf("removed %v, want %v", fc.removes, want)
+	}
+	if len(fc.listed) != 1 || fc.listed[0].ID != "unrelated" {
+		t.Errorf("left %v, want only the unrelated container", fc.listed)
+	}
+}
+
+func TestRunStartErrorIncludesState(t *testing.T) {
+	const stateErr = `exec: "python3": executable file not found in $PATH`
+	for _, startErr := range []error{
+		errors.New("failed to create task for container"),
+		errors.New("failed to create task for container: " + stateErr),
+	} {
+		fc := newFakeClient(t)
+		fc.startErrs = []error{startErr}
+		fc.stateError = stateErr
+		r := newTestRunner(fc)
+
+		_, err := r.Run(context.Background(), fakeRequest())
+		if !errors.Is(err, ErrContainerStart) {
+			t.Fatalf("Run error = %v, want ErrContainerStart", err)
+		}
+		if n := strings.Count(err.Error(), stateErr); n != 1 {
+			t.Errorf("error %q holds the state error %d times, want once", err, n)
+		}
+		if n := fc.called("ContainerRemove"); n != 1 {
+			t.Errorf("ContainerRemove called %d times, want 1", n)
+		}
+	}
+}
+
+func TestRunReadyTimeout(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.startState = "created"
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.ReadyTimeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := r.Run(context.Background(), req)
+	if !errors.Is(err, ErrNotReady) || !strings.Contains(err.Error(), "not running after 100ms") {
+		t.Fatalf("Run error = %v, want ErrNotReady after 100ms", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Run took %s, want it to give up after the ready timeout", d)
+	}
+	if n := fc.called("CopyToContainer") + fc.called("ContainerExecCreate"); n != 0 {
+		t.Errorf("the submission was copied %d times into a container that never became ready", n)
+	}
+	if n := fc.called("ContainerRemove"); n != 1 {
+		t.Errorf("ContainerRemove called %d times, want 1", n)
+	}
+}
+
+func TestCloseIsIdempotent(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithPool(1))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	waitCreated(t, fc, 2)
+	fc.removeErrs = []error{errors.New("remove failed")}
+
+	first := r.Close()
+	if first == nil || !strings.Contains(first.Error(), "remove failed") {
+		t.Fatalf("Close error = %v, want the failed removal of the pooled container", first)
+	}
+	if second := r.Close(); second != first {
+		t.Errorf("second Close returned %v, want the first result %v", second, first)
+	}
+	if fc.closes != 1 {
+		t.Errorf("closed the Docker client %d times, want 1", fc.closes)
+	}
+	if n := fc.called("ContainerRemove"); n != 2 {
+		t.Errorf("ContainerRemove called %d times, want the run's and the pooled container's", n)
+	}
+}
+
+func TestRunAutoRemove(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk("hi\n"), errChunk("warning\n")}, code: 2}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.AutoRemove = true
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "hi\n" || result.Stderr != "warning\n" || result.ExitCode != 2 {
+		t.Errorf("Stdout = %q, Stderr = %q, ExitCode = %d, want the output collected before the removal", result.Stdout, result.Stderr, result.ExitCode)
+	}
+	c := fc.last()
+	if !c.hostConfig.AutoRemove {
+		t.Error("HostConfig.AutoRemove = false, want true")
+	}
+	if _, err := fc.container(c.id); !errdefs.IsNotFound(err) {
+		t.Errorf("inspecting the container after the run: %v, want it gone", err)
+	}
+	if n := fc.called("ContainerLogs"); n != 0 {
+		t.Errorf("ContainerLogs called %d times, want the output attached to instead", n)
+	}
+}
+
+func TestRunAutoRemoveDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	req := RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("print('hi')\n")},
+		AutoRemove:  true,
+		RequestID:   "auto-remove-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "hi\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "hi\n")
+	}
+	left, err := r.dc.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelRequestID+"="+req.RequestID)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d containers of the run are left", len(left))
+	}
+}
+
+func TestRunRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit { return fakeExit{code: 1} }
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.RequestID = "req-42"
+	req.KeepOnFailure = true
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.RequestID != "req-42" || fc.last().config.Labels[labelRequestID] != "req-42" {
+		t.Errorf("RequestID = %q, label %q, want req-42 for both", result.RequestID, fc.last().config.Labels[labelRequestID])
+	}
+	if !strings.Contains(logs.String(), "request_id=req-42 ") {
+		t.Errorf("logs = %q, want the request ID in them", logs.String())
+	}
+
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		result, err := r.Run(context.Background(), fakeRequest())
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if result.RequestID == "" || fc.last().config.Labels[labelRequestID] != result.RequestID {
+			t.Errorf("generated RequestID %q does not match the label %q", result.RequestID, fc.last().config.Labels[labelRequestID])
+		}
+		ids[result.RequestID] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("generated the request IDs %v, want two distinct ones", ids)
+	}
+}
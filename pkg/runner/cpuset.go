@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// validateCpuset checks that cpus is empty or a cpuset list in the kernel's
+// format, i.e. comma-separated CPU numbers and ranges such as "0-1,4".
+func validateCpuset(cpus string) error {
+	if cpus == "" {
+		return nil
+	}
+	for _, part := range strings.Split(cpus, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return fmt.Errorf("cpuset %q: invalid CPU %q", cpus, first)
+		}
+		if !isRange {
+			continue
+		}
+		hi, err := strconv.ParseUint(last, 10, 16)
+		if err != nil {
+			return fmt.Errorf("cpuset %q: invalid CPU %q", cpus, last)
+		}
+		if hi < lo {
+			return fmt.Errorf("cpuset %q: range %s is reversed", cpus, part)
+		}
+	}
+	return nil
+}
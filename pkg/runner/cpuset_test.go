@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunCpuset(t *testing.T) {
+	for _, cpus := range []string{"", "0", "0-1", "0-1,4"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.CpusetCpus = cpus
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run with CpusetCpus %q: %v", cpus, err)
+		}
+		if got := fc.last().hostConfig.CpusetCpus; got != cpus {
+			t.Errorf("CpusetCpus %q: HostConfig has %q", cpus, got)
+		}
+	}
+}
+
+func TestValidateCpuset(t *testing.T) {
+	for _, cpus := range []string{"", "3", "0-3", "0,2-3,7"} {
+		if err := validateCpuset(cpus); err != nil {
+			t.Errorf("validateCpuset(%q): %v", cpus, err)
+		}
+	}
+	for _, cpus := range []string{"a", "-1", "1-", "3-1", "0,,1", "0 1"} {
+		if err := validateCpuset(cpus); err == nil {
+			t.Errorf("validateCpuset(%q) accepted it", cpus)
+		}
+	}
+}
+
+func TestRunCpusetRejects(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.CpusetCpus = "1-0"
+	if _, err := r.Run(context.Background(), req); err == nil {
+		t.Error("Run accepted a reversed cpuset")
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+}
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunDeadlineNamesPhase(t *testing.T) {
+	tests := []struct {
+		phase string
+		setup func(fc *fakeClient)
+	}{
+		{
+			phase: "create_container",
+			setup: func(fc *fakeClient) { fc.createDelay = time.Minute },
+		},
+		{
+			phase: "wait",
+			setup: func(fc *fakeClient) {
+				fc.program = func(c *fakeContainer) fakeExit { return fakeExit{hang: true} }
+			},
+		},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		tt.setup(fc)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Deadline = 50 * time.Millisecond
+		start := time.Now()
+		_, err := r.Run(context.Background(), req)
+		if !errors.Is(err, ErrTimeout) || !strings.HasPrefix(strings.TrimPrefix(err.Error(), ErrTimeout.Error()+": "), tt.phase+": ") {
+			t.Errorf("%s: Run error = %v, want ErrTimeout naming the phase", tt.phase, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: Run took %s, want the deadline to bound it", tt.phase, d)
+		}
+	}
+}
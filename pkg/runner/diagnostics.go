@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is an error the compiler or interpreter reported against a
+// location in the submission, e.g. for a frontend to mark inline.
+type Diagnostic struct {
+	// File is the path of the file relative to the working directory.
+	File string
+
+	// Line and Column are 1-based. Either is 0 when not known.
+	Line   int
+	Column int
+
+	// Message is the error as reported, e.g. "ValueError: bad input".
+	Message string
+}
+
+// gccError matches an error of gcc, e.g. "main.c:3:5: error: expected ';'".
+var gccError = regexp.MustCompile(`^([^:\s][^:]*):(\d+):(?:(\d+):)? (?:fatal )?error: (.*)$`)
+
+// gccDiagnostics parses the errors in the output of gcc. Warnings and notes
+// are left out, as are errors reported against files outside workDir, such
+// as the linker's.
+func gccDiagnostics(output, workDir string) []Diagnostic {
+	var diags []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := gccError.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file := m[1]
+		if path.IsAbs(file) {
+			if !isWithin(path.Clean(file), workDir) {
+				continue
+			}
+			file = strings.TrimPrefix(path.Clean(file), strings.TrimSuffix(workDir, "/")+"/")
+		}
+		n, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		diags = append(diags, Diagnostic{
+			File:    path.Clean(file),
+			Line:    n,
+			Column:  col,
+			Message: m[4],
+		})
+	}
+	return diags
+}
+
+// pythonFrame matches a frame of a Python traceback, as well as the location
+// line of a SyntaxError.
+var pythonFrame = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+
+// pythonDiagnostics parses the tracebacks in the stderr of a Python program.
+// Each traceback is reported at its innermost frame within workDir, so that
+// failures inside the standard library point at the submission's code that
+// led there. Tracebacks without such a frame are left out.
+func pythonDiagnostics(output, workDir string) []Diagnostic {
+	var (
+		diags []Diagnostic
+		frame *Diagnostic
+	)
+	for _, line := range strings.Split(output, "\n") {
+		if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			file := path.Clean(m[1])
+			if !isWithin(file, workDir) {
+				continue
+			}
+			n, _ := strconv.Atoi(m[2])
+			frame = &Diagnostic{
+				File: strings.TrimPrefix(file, strings.TrimSuffix(workDir, "/")+"/"),
+				Line: n,
+			}
+			continue
+		}
+		// The first unindented line after the frames names the exception.
+		if frame != nil && line != "" && !strings.HasPrefix(line, " ") {
+			frame.Message = strings.TrimSpace(line)
+			diags = append(diags, *frame)
+			frame = nil
+		}
+	}
+	return diags
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// traceback is what python3 prints running testdata/traceback.
+const traceback = `Traceback (most recent call last):
+  File "/code/main.py", line 3, in <module>
+    print(calc.ratio(1, 0))
+          ^^^^^^^^^^^^^^^^
+  File "/code/lib/calc.py", line 2, in ratio
+    return a / b
+           ~~^~~
+ZeroDivisionError: division by zero
+`
+
+func TestPythonDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Diagnostic
+	}{
+		{
+			name:   "runtime error",
+			output: traceback,
+			want:   []Diagnostic{{File: "lib/calc.py", Line: 2, Message: "ZeroDivisionError: division by zero"}},
+		},
+		{
+			name: "inside the standard library",
+			output: `Traceback (most recent call last):
+  File "/code/main.py", line 2, in <module>
+    json.loads("{")
+  File "/usr/lib/python3.10/json/__init__.py", line 346, in loads
+    return _default_decoder.decode(s)
+json.decoder.JSONDecodeError: Expecting property name enclosed in double quotes: line 1 column 2 (char 1)
+`,
+			want: []Diagnostic{{File: "main.py", Line: 2, Message: "json.decoder.JSONDecodeError: Expecting property name enclosed in double quotes: line 1 column 2 (char 1)"}},
+		},
+		{
+			name: "syntax error",
+			output: `  File "/code/main.py", line 1
+    print("hi"
+         ^
+SyntaxError: '(' was never closed
+`,
+			want: []Diagnostic{{File: "main.py", Line: 1, Message: "SyntaxError: '(' was never closed"}},
+		},
+		{name: "no traceback", output: "just output\n"},
+	}
+	for _, tt := range tests {
+		if got := pythonDiagnostics(tt.output, codeDir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: pythonDiagnostics = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{errChunk(traceback)}, code: 1}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), RunRequest{Image: fakeImage, SourceDir: "testdata/traceback"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []Diagnostic{{File: "lib/calc.py", Line: 2, Message: "ZeroDivisionError: division by zero"}}
+	if !reflect.DeepEqual(result.Diagnostics, want) {
+		t.Errorf("Diagnostics = %+v, want %+v", result.Diagnostics, want)
+	}
+	if result.Stderr != traceback {
+		t.Errorf("Stderr = %q, want the raw traceback", result.Stderr)
+	}
+}
+
+func TestRunDiagnosticsDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{SourceDir: "testdata/traceback"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].File != "lib/calc.py" || result.Diagnostics[0].Line != 2 {
+		t.Errorf("Diagnostics = %+v, want the division in lib/calc.py on line 2", result.Diagnostics)
+	}
+}
@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DockerClient is the part of the Docker API a Runner uses. *client.Client
+// implements it; other implementations can talk to alternate endpoints or
+// stand in for a daemon in tests.
+type DockerClient interface {
+	ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error)
+	ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
+
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
+	ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error)
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+
+	Info(ctx context.Context) (types.Info, error)
+	Ping(ctx context.Context) (types.Ping, error)
+	Close() error
+}
+
+var _ DockerClient = (*client.Client)(nil)
+
+// NewFromEnv returns a Runner talking to the Docker daemon configured through
+// the environment, i.e. DOCKER_HOST and related variables, negotiating the API
+// version with it. Without DOCKER_HOST, the first socket found by
+// DetectSocket is used.
+func NewFromEnv(opts ...Option) (*Runner, error) {
+	return NewFromEnvVersion("", opts...)
+}
+
+// NewFromEnvVersion is like NewFromEnv, but pins the API version, e.g.
+// "1.41", instead of negotiating it. This saves a round trip and works where
+// the daemon's version endpoint is not reachable. An empty version
+// negotiates.
+func NewFromEnvVersion(version string, opts ...Option) (*Runner, error) {
+	clientOpts := []client.Opt{client.WithHostFromEnv()}
+	if os.Getenv("DOCKER_HOST") == "" {
+		if socket, ok := DetectSocket(); ok {
+			clientOpts = append(clientOpts, client.WithHost("unix://"+socket))
+		}
+	}
+	clientOpts = append(clientOpts, apiVersion(version))
+
+	dc, err := client.NewClientWithOpts(clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(dc, opts...), nil
+}
+
+// NewFromSocket returns a Runner talking to the daemon listening on socket,
+// the path of a Unix socket or a host URL such as "tcp://10.0.0.2:2375". The
+// API version is pinned to version as with NewFromEnvVersion, or negotiated
+// when it is empty.
+//
+// Podman serves a Docker-compatible API on its socket, typically
+// $XDG_RUNTIME_DIR/podman/podman.sock when rootless, which the Runner can use
+// as well. Some limits, such as block IO weights or GPUs, may be unsupported
+// there or by rootless Docker and fail the container's creation.
+func NewFromSocket(socket, version string, opts ...Option) (*Runner, error) {
+	host := socket
+	if !strings.Contains(host, "://") {
+		host = "unix://" + host
+	}
+
+	dc, err := client.NewClientWithOpts(
+		client.WithHost(host),
+		apiVersion(version),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return New(dc, opts...), nil
+}
+
+// apiVersion pins the client to version, or negotiates the version with the
+// daemon when it is empty.
+func apiVersion(version string) client.Opt {
+	if version == "" {
+		return client.WithAPIVersionNegotiation()
+	}
+	return client.WithVersion(version)
+}
+
+// DetectSocket returns the first daemon socket found among the usual
+// locations: the system-wide Docker socket, the socket of rootless Docker and
+// the sockets of rootless and rootful Podman.
+func DetectSocket() (string, bool) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+
+	candidates := []string{
+		"/var/run/docker.sock",
+		filepath.Join(runtimeDir, "docker.sock"),
+		filepath.Join(runtimeDir, "podman", "podman.sock"),
+		"/run/podman/podman.sock",
+	}
+	for _, socket := range candidates {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return socket, true
+		}
+	}
+	return "", false
+}
+
+// Ping checks that the Docker daemon is reachable, e.g. for a readiness probe,
+// and returns what it reports about itself, such as its API version. Failures
+// wrap ErrDaemonUnreachable.
+func (r *Runner) Ping(ctx context.Context) (types.Ping, error) {
+	ping, err := r.dc.Ping(ctx)
+	if err != nil {
+		return types.Ping{}, fmt.Errorf("%w: %w", ErrDaemonUnreachable, err)
+	}
+	return ping, nil
+}
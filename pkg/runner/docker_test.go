@@ -0,0 +1,223 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestRunUsesInjectedClient(t *testing.T) {
+	fc := newFakeClient(t)
+	r := New(fc, WithTimerScript(testTimerScript))
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want 0", result.ExitCode)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The whole lifecycle of the run goes through the injected client.
+	want := []string{"ImageList", "ContainerCreate", "ContainerWait", "ContainerStart", "ContainerExecCreate", "ContainerLogs", "ContainerRemove", "Close"}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	i := 0
+	for _, call := range fc.calls {
+		if i < len(want) && call == want[i] {
+			i++
+		}
+	}
+	if i != len(want) {
+		t.Errorf("calls = %v, want %v among them in order", fc.calls, want)
+	}
+}
+
+// fakeDaemon serves the Docker API for version negotiation, reporting
+// apiVersion, and records the paths of the requests it gets.
+func fakeDaemon(t *testing.T, apiVersion string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		paths = append(paths, req.URL.Path)
+		mu.Unlock()
+		w.Header().Set("API-Version", apiVersion)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+// serveUnix makes ts listen on a Unix socket at path instead of TCP.
+func serveUnix(t *testing.T, ts *httptest.Server, path string) {
+	t.Helper()
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	t.Cleanup(ts.Close)
+}
+
+func TestNewFromSocket(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		paths = append(paths, req.URL.Path)
+		mu.Unlock()
+		w.Header().Set("API-Version", "1.41")
+		io.WriteString(w, "{}")
+	}))
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	serveUnix(t, ts, socket)
+
+	r, err := NewFromSocket(socket, "")
+	if err != nil {
+		t.Fatalf("NewFromSocket: %v", err)
+	}
+	defer r.Close()
+	if host := r.dc.(*client.Client).DaemonHost(); host != "unix://"+socket {
+		t.Errorf("DaemonHost = %q, want unix://%s", host, socket)
+	}
+	if _, err := r.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	mu.Lock()
+	if len(paths) == 0 {
+		t.Error("the daemon on the socket got no request")
+	}
+	paths = nil
+	mu.Unlock()
+
+	// A pinned version is used as is on the socket.
+	r, err = NewFromSocket(socket, "1.39")
+	if err != nil {
+		t.Fatalf("NewFromSocket: %v", err)
+	}
+	defer r.Close()
+	if _, err := r.dc.Info(context.Background()); err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	mu.Lock()
+	if len(paths) != 1 || paths[0] != "/v1.39/info" {
+		t.Errorf("requested %v, want only /v1.39/info", paths)
+	}
+	mu.Unlock()
+
+	r, err = NewFromSocket("tcp://10.0.0.2:2375", "")
+	if err != nil {
+		t.Fatalf("NewFromSocket: %v", err)
+	}
+	defer r.Close()
+	if host := r.dc.(*client.Client).DaemonHost(); host != "tcp://10.0.0.2:2375" {
+		t.Errorf("DaemonHost = %q, want the host URL kept", host)
+	}
+}
+
+func TestDetectSocket(t *testing.T) {
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		t.Skip("the system-wide Docker socket takes precedence")
+	}
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	if socket, ok := DetectSocket(); ok && socket != "/run/podman/podman.sock" {
+		t.Errorf("DetectSocket = %q without sockets in the runtime directory", socket)
+	}
+
+	if err := os.Mkdir(filepath.Join(runtimeDir, "podman"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(runtimeDir, "podman", "podman.sock")
+	l, err := net.Listen("unix", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if socket, ok := DetectSocket(); socket != want || !ok {
+		t.Errorf("DetectSocket = %q, %t, want %q", socket, ok, want)
+	}
+}
+
+func TestNewFromEnvVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "", want: "/v1.40/info"},
+		{version: "1.41", want: "/v1.41/info"},
+	}
+	for _, tt := range tests {
+		ts, paths := fakeDaemon(t, "1.40")
+		t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(ts.URL, "http://"))
+
+		r, err := NewFromEnvVersion(tt.version)
+		if err != nil {
+			t.Fatalf("NewFromEnvVersion(%q): %v", tt.version, err)
+		}
+		if _, err := r.dc.Info(context.Background()); err != nil {
+			t.Fatalf("Info: %v", err)
+		}
+		r.Close()
+
+		got := paths()
+		if len(got) == 0 || got[len(got)-1] != tt.want {
+			t.Errorf("version %q: requested %v, want %s last", tt.version, got, tt.want)
+		}
+		if negotiated := len(got) > 1; negotiated != (tt.version == "") {
+			t.Errorf("version %q: requested %v, want negotiation only without a pinned version", tt.version, got)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	ping, err := r.Ping(context.Background())
+	if err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if ping.APIVersion != "1.42" || ping.OSType != "linux" {
+		t.Errorf("Ping = %+v, want the daemon's version info", ping)
+	}
+
+	fc.pingErr = errors.New("dial unix /var/run/docker.sock: connect: connection refused")
+	_, err = r.Ping(context.Background())
+	if !errors.Is(err, ErrDaemonUnreachable) {
+		t.Fatalf("Ping error = %v, want ErrDaemonUnreachable", err)
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("error %q does not include the cause", err)
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+}
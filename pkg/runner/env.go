@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envKeyPattern matches the environment variable names a program may be given.
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runnerEnv holds the environment variables the runner sets itself. HOME
+// points at the writable /tmp, as the program runs as a user without a home
+// directory on a read-only root filesystem.
+var runnerEnv = map[string]string{
+	"HOME": "/tmp",
+}
+
+// containerEnv returns env merged with runnerEnv in KEY=value form, sorted by
+// key. It rejects malformed keys, values containing NUL bytes and attempts to
+// override a variable in runnerEnv.
+func containerEnv(env map[string]string) ([]string, error) {
+	vars := make([]string, 0, len(env)+len(runnerEnv))
+	for key, value := range env {
+		if !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			return nil, fmt.Errorf("environment variable %s contains a NUL byte", key)
+		}
+		if _, ok := runnerEnv[key]; ok {
+			return nil, fmt.Errorf("environment variable %s is set by the runner and cannot be overridden", key)
+		}
+		vars = append(vars, key+"="+value)
+	}
+	for key, value := range runnerEnv {
+		vars = append(vars, key+"="+value)
+	}
+
+	sort.Strings(vars)
+	return vars, nil
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunEnv(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		for _, v := range c.config.Env {
+			if v == "FOO=bar" {
+				return fakeExit{output: []fakeChunk{outChunk("bar\n")}}
+			}
+		}
+		return fakeExit{code: 1}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Env = map[string]string{"FOO": "bar"}
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "bar\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "bar\n")
+	}
+	if want := []string{"FOO=bar", "HOME=/tmp"}; !reflect.DeepEqual(fc.last().config.Env, want) {
+		t.Errorf("Env = %q, want %q", fc.last().config.Env, want)
+	}
+}
+
+func TestContainerEnvRejects(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"FOO=BAR": "x"},
+		{"1FOO": "x"},
+		{"FOO": "a\x00b"},
+		{"HOME": "/root"},
+	} {
+		if _, err := containerEnv(env); err == nil {
+			t.Errorf("containerEnv accepted %q", env)
+		}
+	}
+}
+
+func TestRunEnvDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("import os\nprint(os.environ['FOO'])\n")},
+		Env:         map[string]string{"FOO": "bar"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "bar\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "bar\n")
+	}
+}
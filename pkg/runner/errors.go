@@ -0,0 +1,78 @@
+package runner
+
+import "errors"
+
+// Errors identifying why a run failed, to be matched with errors.Is.
+var (
+	// ErrUnknownLanguage is returned when RunRequest.Language names no
+	// registered language.
+	ErrUnknownLanguage = errors.New("unknown language")
+
+	// ErrAmbiguousLanguage is returned when RunRequest.Language is empty and
+	// the submission's files match several languages equally well.
+	ErrAmbiguousLanguage = errors.New("ambiguous language")
+
+	// ErrSourceEmpty is returned when a submission contains no files.
+	ErrSourceEmpty = errors.New("no source files")
+
+	// ErrSourceTooLarge is returned when a submission exceeds
+	// RunRequest.MaxSourceBytes, MaxFileBytes or MaxFiles.
+	ErrSourceTooLarge = errors.New("source limit exceeded")
+
+	// ErrInvalidRequest is returned when a RunRequest is rejected before
+	// anything is done on the daemon, e.g. for a negative limit or a file
+	// name leaving the working directory.
+	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrDaemonUnreachable is returned by Runner.Ping when the Docker daemon
+	// does not answer.
+	ErrDaemonUnreachable = errors.New("docker daemon unreachable")
+
+	// ErrUnsafeDaemon is returned when WithStrictIsolation is set and the
+	// daemon does not isolate containers from the host's root user.
+	ErrUnsafeDaemon = errors.New("daemon does not isolate containers")
+
+	// ErrImageNotFound is returned when an image other than the runner's own
+	// is not present on the daemon.
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrImageBuild is returned when the runner image could not be built.
+	ErrImageBuild = errors.New("image build failed")
+
+	// ErrImagePull is returned when the image configured through
+	// WithPullImage could not be pulled.
+	ErrImagePull = errors.New("image pull failed")
+
+	// ErrContainerCreate is returned when the container could not be created.
+	ErrContainerCreate = errors.New("container creation failed")
+
+	// ErrContainerStart is returned when the container could not be started.
+	ErrContainerStart = errors.New("container start failed")
+
+	// ErrNotReady is returned when a container started ahead of copying the
+	// submission into it does not come up in time.
+	ErrNotReady = errors.New("container not ready")
+
+	// ErrTimeout is returned when the run's context deadline expires. A
+	// program exceeding RunRequest.Timeout is not a failure of the run, see
+	// RunResult.Err.
+	ErrTimeout = errors.New("run timed out")
+
+	// ErrOOMKilled reports that the program was killed for exceeding its
+	// memory limit, see RunResult.Err.
+	ErrOOMKilled = errors.New("program killed for running out of memory")
+)
+
+// Err reports a program that did not exit by itself as ErrTimeout or
+// ErrOOMKilled, and returns nil otherwise. Such programs are legitimate
+// results rather than failures of the run, so Run does not return these as
+// errors.
+func (res RunResult) Err() error {
+	switch {
+	case res.OOMKilled:
+		return ErrOOMKilled
+	case res.TimedOut:
+		return ErrTimeout
+	}
+	return nil
+}
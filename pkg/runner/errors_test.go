@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunErrors(t *testing.T) {
+	hang := func(c *fakeContainer) fakeExit { return fakeExit{hang: true} }
+	tests := []struct {
+		name  string
+		setup func(fc *fakeClient, req *RunRequest) []Option
+		want  error
+	}{
+		{
+			name: "unknown language",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.Language = "cobol"
+				return nil
+			},
+			want: ErrUnknownLanguage,
+		},
+		{
+			name: "ambiguous language",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.SourceFiles = map[string][]byte{"main.py": nil, "main.js": nil}
+				return nil
+			},
+			want: ErrAmbiguousLanguage,
+		},
+		{
+			name: "source empty",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.SourceFiles = nil
+				return nil
+			},
+			want: ErrSourceEmpty,
+		},
+		{
+			name: "source too large",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.MaxFileBytes = 4
+				return nil
+			},
+			want: ErrSourceTooLarge,
+		},
+		{
+			name: "invalid request",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.CPUs = -1
+				return nil
+			},
+			want: ErrInvalidRequest,
+		},
+		{
+			name: "image not found",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.Image = "missing"
+				return nil
+			},
+			want: ErrImageNotFound,
+		},
+		{
+			name: "image build",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.Image = ""
+				fc.buildBody = `{"errorDetail":{"message":"RUN failed"},"error":"RUN failed"}`
+				return []Option{WithBuildContext(writeBuildContext(t, "FROM scratch\n"), "")}
+			},
+			want: ErrImageBuild,
+		},
+		{
+			name: "image pull",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				req.Image = ""
+				fc.pullBody = `{"errorDetail":{"message":"not found"},"error":"not found"}`
+				return []Option{WithPullImage("registry.example.com/runner:1")}
+			},
+			want: ErrImagePull,
+		},
+		{
+			name: "container create",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				fc.createErrs = []error{errors.New("create failed")}
+				return nil
+			},
+			want: ErrContainerCreate,
+		},
+		{
+			name: "container start",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				fc.startErrs = []error{errors.New("start failed")}
+				return nil
+			},
+			want: ErrContainerStart,
+		},
+		{
+			name: "not ready",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				fc.startState = "exited"
+				return nil
+			},
+			want: ErrNotReady,
+		},
+		{
+			name: "deadline",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				fc.program = hang
+				req.Deadline = 50 * time.Millisecond
+				return nil
+			},
+			want: ErrTimeout,
+		},
+		{
+			name: "unsafe daemon",
+			setup: func(fc *fakeClient, req *RunRequest) []Option {
+				return []Option{WithStrictIsolation()}
+			},
+			want: ErrUnsafeDaemon,
+		},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		req := fakeRequest()
+		r := newTestRunner(fc, tt.setup(fc, &req)...)
+
+		_, err := r.Run(context.Background(), req)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Run error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRunInvalidRequest(t *testing.T) {
+	invalid := []func(req *RunRequest){
+		func(req *RunRequest) { req.Language = "cobol" },
+		func(req *RunRequest) { req.SourceFiles = nil },
+		func(req *RunRequest) { req.MaxOutputBytes = -1 },
+		func(req *RunRequest) { req.MaxFileBytes = 4 },
+		func(req *RunRequest) { req.EntryFile = "missing.py" },
+		func(req *RunRequest) { req.SourceFiles = map[string][]byte{"../main.py": nil} },
+	}
+	for i, modify := range invalid {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		modify(&req)
+		if _, err := r.Run(context.Background(), req); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("request %d: Run error = %v, want ErrInvalidRequest", i, err)
+		}
+	}
+
+	// Failures of the daemon are not the request's.
+	fc := newFakeClient(t)
+	fc.createErrs = []error{errors.New("create failed")}
+	r := newTestRunner(fc)
+	if _, err := r.Run(context.Background(), fakeRequest()); err == nil || errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Run error = %v, want a failure other than ErrInvalidRequest", err)
+	}
+}
+
+func TestPingError(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.pingErr = errors.New("connection refused")
+	r := newTestRunner(fc)
+
+	if _, err := r.Ping(context.Background()); !errors.Is(err, ErrDaemonUnreachable) {
+		t.Errorf("Ping error = %v, want ErrDaemonUnreachable", err)
+	}
+}
+
+func TestRunResultErr(t *testing.T) {
+	tests := []struct {
+		result RunResult
+		want   error
+	}{
+		{result: RunResult{ExitCode: 1}},
+		{result: RunResult{TimedOut: true, ExitCode: 137}, want: ErrTimeout},
+		{result: RunResult{OOMKilled: true, ExitCode: 137}, want: ErrOOMKilled},
+	}
+	for _, tt := range tests {
+		if err := tt.result.Err(); !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("Err() of %+v = %v, want %v", tt.result, err, tt.want)
+		}
+	}
+}
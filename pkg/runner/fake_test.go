@@ -0,0 +1,926 @@
+package runner
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeImage is the image the fake daemon has from the start.
+const fakeImage = "fake-image"
+
+// testTimerScript is the repository's timer.sh wrapper, relative to this
+// package.
+const testTimerScript = "../../runner/timer.sh"
+
+// fakeChunk is a piece of output a fake program prints.
+type fakeChunk struct {
+	stderr bool
+	data   string
+
+	// delay is waited before the chunk is printed.
+	delay time.Duration
+}
+
+// outChunk and errChunk return chunks printed to stdout and stderr.
+func outChunk(data string) fakeChunk { return fakeChunk{data: data} }
+func errChunk(data string) fakeChunk { return fakeChunk{stderr: true, data: data} }
+
+// fakeExit describes what a fake program does once it runs.
+type fakeExit struct {
+	output []fakeChunk
+	code   int
+
+	// files are written to the working directory, keyed by their path
+	// relative to it, before the program exits.
+	files map[string]string
+
+	oomKilled bool
+
+	// waitError is reported by ContainerWait instead of the exit.
+	waitError string
+
+	// hang keeps the program running after its output until it is stopped.
+	// onTerm is printed when it is stopped with a grace period, after which
+	// it exits with code 143, or 137 when it is killed.
+	hang   bool
+	onTerm []fakeChunk
+}
+
+// fakeContainer is a container of the fake daemon.
+type fakeContainer struct {
+	id         string
+	name       string
+	created    time.Time
+	config     *container.Config
+	hostConfig *container.HostConfig
+
+	// files holds the packed files by their path relative to copyDir, the
+	// directory they were copied or extracted to. headers holds their tar
+	// headers.
+	copyDir string
+	files   map[string][]byte
+	headers map[string]*tar.Header
+
+	stdin     bytes.Buffer
+	stdinDone chan struct{}
+	ready     chan struct{}
+	term      chan struct{}
+	kill      chan struct{}
+	done      chan struct{}
+	logR      *io.PipeReader
+	logW      *io.PipeWriter
+
+	// Guarded by fakeClient.mu.
+	state      string
+	exit       fakeExit
+	stateError string
+	removed    bool
+	termOnce   sync.Once
+	killOnce   sync.Once
+}
+
+// fakeClient is a DockerClient standing in for a daemon. Programs do not run;
+// instead, program decides what the container of a run prints and how it
+// exits. Calls are recorded for tests to inspect.
+type fakeClient struct {
+	t testing.TB
+
+	// program returns what the program of c does. It defaults to exiting
+	// with status zero without printing anything.
+	program func(c *fakeContainer) fakeExit
+
+	mu sync.Mutex
+
+	images []types.ImageSummary
+	listed []types.Container
+	info   types.Info
+
+	// *Errs are returned by the next calls to the method, one each, before
+	// it succeeds again.
+	createErrs []error
+	startErrs  []error
+	removeErrs []error
+
+	buildErr  error
+	buildBody string
+	pullBody  string
+	pingErr   error
+	statsErr  error
+	memUsage  uint64
+	tarStatus int
+
+	// createDelay is how long ContainerCreate takes, as it would on a
+	// daemon, unless its context is done first.
+	createDelay time.Duration
+
+	// stateError is recorded in the state of a container failing to start.
+	stateError string
+
+	// exitHook, when set, is called once a program has exited, before
+	// ContainerWait reports it.
+	exitHook func()
+
+	// startState, when set, is the state a started container is reported in
+	// instead of running.
+	startState string
+
+	containers map[string]*fakeContainer
+	created    []*fakeContainer
+	execs      map[string]*fakeExec
+
+	builds        int
+	buildContexts [][]byte
+	buildOptions  []types.ImageBuildOptions
+	pulls         []string
+	starts        []string
+	stops         []string
+	removes       []string
+	removedImages []string
+	closes        int
+	calls         []string
+}
+
+// fakeExec is an exec instance of the fake daemon.
+type fakeExec struct {
+	containerID string
+	config      types.ExecConfig
+	exitCode    int
+}
+
+func newFakeClient(t testing.TB) *fakeClient {
+	return &fakeClient{
+		t: t,
+		images: []types.ImageSummary{{
+			ID:       "sha256:fake",
+			RepoTags: []string{fakeImage},
+		}},
+		containers: make(map[string]*fakeContainer),
+		execs:      make(map[string]*fakeExec),
+	}
+}
+
+var _ DockerClient = (*fakeClient)(nil)
+
+// newTestRunner returns a Runner using fc and the repository's timer.sh, with
+// retries that are quick enough for tests.
+func newTestRunner(fc *fakeClient, opts ...Option) *Runner {
+	opts = append([]Option{
+		WithTimerScript(testTimerScript),
+		WithRetry(defaultRetryAttempts, time.Millisecond),
+	}, opts...)
+	return New(fc, opts...)
+}
+
+// fakeRequest returns a request running a Python submission on the fake
+// image.
+func fakeRequest() RunRequest {
+	return RunRequest{
+		Image: fakeImage,
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("print('hi')\n"),
+		},
+	}
+}
+
+func (fc *fakeClient) record(call string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.calls = append(fc.calls, call)
+}
+
+// called reports how often method was called.
+func (fc *fakeClient) called(method string) int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	n := 0
+	for _, call := range fc.calls {
+		if call == method {
+			n++
+		}
+	}
+	return n
+}
+
+// last returns the container created last.
+func (fc *fakeClient) last() *fakeContainer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.created) == 0 {
+		fc.t.Fatal("no container was created")
+	}
+	return fc.created[len(fc.created)-1]
+}
+
+func (fc *fakeClient) container(id string) (*fakeContainer, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	c, ok := fc.containers[id]
+	if !ok || c.removed {
+		return nil, errdefs.NotFound(fmt.Errorf("no such container: %s", id))
+	}
+	return c, nil
+}
+
+// pop returns the first of errs and the remaining ones.
+func pop(errs []error) (error, []error) {
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	return errs[0], errs[1:]
+}
+
+func (fc *fakeClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	fc.record("ImageList")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	refs := options.Filters.Get("reference")
+	labels := options.Filters.Get("label")
+	var result []types.ImageSummary
+	for _, img := range fc.images {
+		if len(refs) > 0 && !hasTag(img.RepoTags, refs[0]) {
+			continue
+		}
+		if len(labels) > 0 && !hasLabel(img.Labels, labels[0]) {
+			continue
+		}
+		result = append(result, img)
+	}
+	return result, nil
+}
+
+// hasLabel reports whether labels hold label, given as "key=value".
+func hasLabel(labels map[string]string, label string) bool {
+	key, value, _ := strings.Cut(label, "=")
+	v, ok := labels[key]
+	return ok && v == value
+}
+
+func (fc *fakeClient) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	fc.record("ImageBuild")
+	b, err := io.ReadAll(buildContext)
+	if err != nil {
+		return types.ImageBuildResponse{}, err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.builds++
+	fc.buildContexts = append(fc.buildContexts, b)
+	fc.buildOptions = append(fc.buildOptions, options)
+	if fc.buildErr != nil {
+		return types.ImageBuildResponse{}, fc.buildErr
+	}
+
+	body := fc.buildBody
+	if body == "" {
+		body = `{"stream":"Successfully built\n"}`
+	}
+	if !strings.Contains(body, `"error"`) {
+		fc.images = append(fc.images, types.ImageSummary{
+			ID:       fmt.Sprintf("sha256:built%d", fc.builds),
+			RepoTags: options.Tags,
+			Labels:   options.Labels,
+		})
+	}
+	return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (fc *fakeClient) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	fc.record("ImagePull")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.pulls = append(fc.pulls, ref)
+
+	body := fc.pullBody
+	if body == "" {
+		body = `{"status":"Downloaded newer image"}`
+	}
+	if !strings.Contains(body, `"error"`) {
+		fc.images = append(fc.images, types.ImageSummary{
+			ID:       "sha256:pulled",
+			RepoTags: []string{ref},
+		})
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+func (fc *fakeClient) ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	fc.record("ImageRemove")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.removedImages = append(fc.removedImages, imageID)
+	return []types.ImageDeleteResponseItem{{Deleted: imageID}}, nil
+}
+
+func (fc *fakeClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+	fc.record("ContainerCreate")
+	fc.mu.Lock()
+	delay := fc.createDelay
+	fc.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return container.CreateResponse{}, ctx.Err()
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	var err error
+	if err, fc.createErrs = pop(fc.createErrs); err != nil {
+		return container.CreateResponse{}, err
+	}
+	for _, c := range fc.containers {
+		if containerName != "" && c.name == containerName && !c.removed {
+			return container.CreateResponse{}, errdefs.Conflict(fmt.Errorf("name %s is already in use", containerName))
+		}
+	}
+
+	logR, logW := io.Pipe()
+	c := &fakeContainer{
+		id:         fmt.Sprintf("container%d", len(fc.containers)+1),
+		name:       containerName,
+		created:    time.Now(),
+		config:     config,
+		hostConfig: hostConfig,
+		files:      make(map[string][]byte),
+		headers:    make(map[string]*tar.Header),
+		stdinDone:  make(chan struct{}),
+		ready:      make(chan struct{}),
+		term:       make(chan struct{}),
+		kill:       make(chan struct{}),
+		done:       make(chan struct{}),
+		logR:       logR,
+		logW:       logW,
+		state:      "created",
+	}
+	if !config.OpenStdin {
+		close(c.stdinDone)
+	}
+	if !isGated(config.Cmd) {
+		close(c.ready)
+	}
+	fc.containers[c.id] = c
+	fc.created = append(fc.created, c)
+	return container.CreateResponse{ID: c.id}, nil
+}
+
+// isGated reports whether cmd was wrapped with gateCmd.
+func isGated(cmd []string) bool {
+	return len(cmd) > 2 && strings.Contains(cmd[2], readyMarker)
+}
+
+func (fc *fakeClient) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	fc.record("ContainerStart")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	fc.mu.Lock()
+	fc.starts = append(fc.starts, containerID)
+	if err, fc.startErrs = pop(fc.startErrs); err != nil {
+		c.stateError = fc.stateError
+		fc.mu.Unlock()
+		return err
+	}
+	c.state = "running"
+	if fc.startState != "" {
+		c.state = fc.startState
+	}
+	fc.mu.Unlock()
+
+	go fc.execute(c)
+	return nil
+}
+
+// execute plays the program of c once its submission and input are in place.
+func (fc *fakeClient) execute(c *fakeContainer) {
+	select {
+	case <-c.ready:
+	case <-c.kill:
+		fc.exited(c, fakeExit{code: 137})
+		return
+	}
+	select {
+	case <-c.stdinDone:
+	case <-c.kill:
+		fc.exited(c, fakeExit{code: 137})
+		return
+	}
+
+	exit := fakeExit{}
+	if fc.program != nil {
+		exit = fc.program(c)
+	}
+
+	var stdoutW, stderrW io.Writer = c.logW, c.logW
+	if !c.config.Tty {
+		stdoutW = stdcopy.NewStdWriter(c.logW, stdcopy.Stdout)
+		stderrW = stdcopy.NewStdWriter(c.logW, stdcopy.Stderr)
+	}
+	write := func(chunks []fakeChunk) bool {
+		for _, chunk := range chunks {
+			if chunk.delay > 0 {
+				select {
+				case <-time.After(chunk.delay):
+				case <-c.kill:
+					return false
+				}
+			}
+			w := stdoutW
+			if chunk.stderr {
+				w = stderrW
+			}
+			if _, err := io.WriteString(w, chunk.data); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !write(exit.output) {
+		exit.code = 137
+	} else if exit.hang {
+		select {
+		case <-c.term:
+			write(exit.onTerm)
+			exit.code = 143
+		case <-c.kill:
+			exit.code = 137
+		}
+	}
+	fc.exited(c, exit)
+}
+
+// exited records the exit of c's program.
+func (fc *fakeClient) exited(c *fakeContainer, exit fakeExit) {
+	fc.mu.Lock()
+	c.state = "exited"
+	c.exit = exit
+	for name, contents := range exit.files {
+		c.files[name] = []byte(contents)
+	}
+	if c.hostConfig.AutoRemove {
+		c.removed = true
+	}
+	hook := fc.exitHook
+	fc.mu.Unlock()
+
+	c.logW.Close()
+	if hook != nil {
+		hook()
+	}
+	close(c.done)
+}
+
+func (fc *fakeClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	fc.record("ContainerWait")
+	wr := make(chan container.WaitResponse, 1)
+	errCh := make(chan error, 1)
+
+	c, err := fc.container(containerID)
+	if err != nil {
+		errCh <- err
+		return wr, errCh
+	}
+	go func() {
+		select {
+		case <-c.done:
+			fc.mu.Lock()
+			resp := container.WaitResponse{StatusCode: int64(c.exit.code)}
+			if c.exit.waitError != "" {
+				resp.Error = &container.WaitExitError{Message: c.exit.waitError}
+			}
+			fc.mu.Unlock()
+			wr <- resp
+		case <-ctx.Done():
+			errCh <- ctx.Err()
+		}
+	}()
+	return wr, errCh
+}
+
+func (fc *fakeClient) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	fc.record("ContainerStop")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	fc.mu.Lock()
+	fc.stops = append(fc.stops, containerID)
+	fc.mu.Unlock()
+	if options.Timeout != nil && *options.Timeout > 0 {
+		c.termOnce.Do(func() { close(c.term) })
+	} else {
+		c.killOnce.Do(func() { close(c.kill) })
+	}
+
+	fc.mu.Lock()
+	started := c.state != "created"
+	fc.mu.Unlock()
+	if !started {
+		return nil
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (fc *fakeClient) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	fc.record("ContainerRemove")
+	fc.mu.Lock()
+	fc.removes = append(fc.removes, containerID)
+	var err error
+	if err, fc.removeErrs = pop(fc.removeErrs); err != nil {
+		fc.mu.Unlock()
+		return err
+	}
+	for i, listed := range fc.listed {
+		if listed.ID == containerID {
+			fc.listed = append(fc.listed[:i], fc.listed[i+1:]...)
+			fc.mu.Unlock()
+			return nil
+		}
+	}
+	c, ok := fc.containers[containerID]
+	if !ok || c.removed {
+		fc.mu.Unlock()
+		return errdefs.NotFound(fmt.Errorf("no such container: %s", containerID))
+	}
+	c.removed = true
+	fc.mu.Unlock()
+
+	c.killOnce.Do(func() { close(c.kill) })
+	c.logR.CloseWithError(errors.New("container removed"))
+	return nil
+}
+
+func (fc *fakeClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	fc.record("ContainerInspect")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   c.id,
+			Name: "/" + c.name,
+			State: &types.ContainerState{
+				Status:    c.state,
+				Running:   c.state == "running",
+				ExitCode:  c.exit.code,
+				OOMKilled: c.exit.oomKilled,
+				Error:     c.stateError,
+			},
+			HostConfig: c.hostConfig,
+		},
+		Config: c.config,
+	}, nil
+}
+
+func (fc *fakeClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	fc.record("ContainerList")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	labels := options.Filters.Get("label")
+	matches := func(l map[string]string) bool {
+		return len(labels) == 0 || hasLabel(l, labels[0])
+	}
+	var result []types.Container
+	for _, c := range fc.listed {
+		if matches(c.Labels) {
+			result = append(result, c)
+		}
+	}
+	for _, c := range fc.created {
+		if !c.removed && matches(c.config.Labels) {
+			result = append(result, types.Container{
+				ID:      c.id,
+				Created: c.created.Unix(),
+				Labels:  c.config.Labels,
+				State:   c.state,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (fc *fakeClient) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	fc.record("ContainerLogs")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return nil, err
+	}
+	return c.logR, nil
+}
+
+func (fc *fakeClient) ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	fc.record("ContainerStats")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.statsErr != nil {
+		return types.ContainerStats{}, fc.statsErr
+	}
+
+	var s types.StatsJSON
+	s.MemoryStats.Usage = fc.memUsage
+	b, err := json.Marshal(s)
+	if err != nil {
+		return types.ContainerStats{}, err
+	}
+	return types.ContainerStats{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (fc *fakeClient) ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	fc.record("ContainerAttach")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	if !options.Stdin {
+		return hijacked(c.logR, nil), nil
+	}
+	inR, inW := io.Pipe()
+	go func() {
+		b, _ := io.ReadAll(inR)
+		fc.mu.Lock()
+		c.stdin.Write(b)
+		fc.mu.Unlock()
+		close(c.stdinDone)
+	}()
+	return hijacked(strings.NewReader(""), inW), nil
+}
+
+func (fc *fakeClient) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	fc.record("CopyToContainer")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return err
+	}
+	_, err = fc.unpack(c, dstPath, content)
+	return err
+}
+
+// unpack reads the tar content into the files of c, returning the total size
+// of the files.
+func (fc *fakeClient) unpack(c *fakeContainer, dir string, content io.Reader) (int64, error) {
+	var size int64
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return size, err
+		}
+		size += int64(len(b))
+
+		fc.mu.Lock()
+		c.copyDir = dir
+		c.headers[header.Name] = header
+		if header.Typeflag == tar.TypeReg {
+			c.files[header.Name] = b
+		}
+		fc.mu.Unlock()
+	}
+}
+
+func (fc *fakeClient) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	fc.record("CopyFromContainer")
+	c, err := fc.container(containerID)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	rel := strings.TrimPrefix(strings.TrimPrefix(srcPath, c.config.WorkingDir), "/")
+	var names []string
+	for name := range c.files {
+		if name == rel || strings.HasPrefix(name, rel+"/") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(fmt.Errorf("no such path: %s", srcPath))
+	}
+	sort.Strings(names)
+
+	// Entries are named relative to the parent of srcPath, as the daemon
+	// does.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	parent := path.Dir(rel)
+	for _, name := range names {
+		entry := name
+		if parent != "." {
+			entry = strings.TrimPrefix(name, parent+"/")
+		}
+		contents := c.files[name]
+		tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+		})
+		tw.Write(contents)
+	}
+	tw.Close()
+	return io.NopCloser(&buf), types.ContainerPathStat{Name: path.Base(rel)}, nil
+}
+
+func (fc *fakeClient) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	fc.record("ContainerExecCreate")
+	if _, err := fc.container(containerID); err != nil {
+		return types.IDResponse{}, err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	id := fmt.Sprintf("exec%d", len(fc.execs)+1)
+	fc.execs[id] = &fakeExec{containerID: containerID, config: config}
+	return types.IDResponse{ID: id}, nil
+}
+
+// ContainerExecAttach runs the tar command of extractCode: the submission is
+// read from the connection into the container, failing like a full tmpfs when
+// it exceeds the tmpfs at the target directory.
+func (fc *fakeClient) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	fc.record("ContainerExecAttach")
+	fc.mu.Lock()
+	exec, ok := fc.execs[execID]
+	fc.mu.Unlock()
+	if !ok {
+		return types.HijackedResponse{}, errdefs.NotFound(fmt.Errorf("no such exec: %s", execID))
+	}
+	c, err := fc.container(exec.containerID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	dir := exec.config.Cmd[len(exec.config.Cmd)-2]
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		size, err := fc.unpack(c, dir, inR)
+		io.Copy(io.Discard, inR)
+
+		status := 0
+		w := stdcopy.NewStdWriter(outW, stdcopy.Stderr)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "tar: %v\n", err)
+			status = 2
+		case size > fakeTmpfsSize(c.hostConfig.Tmpfs[dir]):
+			fmt.Fprintln(w, "tar: write error: No space left on device")
+			status = 2
+		default:
+			fc.mu.Lock()
+			status = fc.tarStatus
+			fc.mu.Unlock()
+		}
+		fc.mu.Lock()
+		exec.exitCode = status
+		fc.mu.Unlock()
+		if status == 0 {
+			close(c.ready)
+		}
+		outW.Close()
+	}()
+	return hijacked(outR, inW), nil
+}
+
+// fakeTmpfsSize returns the size option of the tmpfs options, or the largest size
+// when there is none.
+func fakeTmpfsSize(options string) int64 {
+	for _, opt := range strings.Split(options, ",") {
+		if v, ok := strings.CutPrefix(opt, "size="); ok {
+			n, _ := strconv.ParseInt(v, 10, 64)
+			return n
+		}
+	}
+	return 1<<63 - 1
+}
+
+func (fc *fakeClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	fc.record("ContainerExecInspect")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	exec, ok := fc.execs[execID]
+	if !ok {
+		return types.ContainerExecInspect{}, errdefs.NotFound(fmt.Errorf("no such exec: %s", execID))
+	}
+	return types.ContainerExecInspect{
+		ExecID:      execID,
+		ContainerID: exec.containerID,
+		ExitCode:    exec.exitCode,
+	}, nil
+}
+
+func (fc *fakeClient) Info(ctx context.Context) (types.Info, error) {
+	fc.record("Info")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.info, nil
+}
+
+func (fc *fakeClient) Ping(ctx context.Context) (types.Ping, error) {
+	fc.record("Ping")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.pingErr != nil {
+		return types.Ping{}, fc.pingErr
+	}
+	return types.Ping{APIVersion: "1.42", OSType: "linux"}, nil
+}
+
+func (fc *fakeClient) Close() error {
+	fc.record("Close")
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.closes++
+	return nil
+}
+
+// fakeConn is the connection of a hijacked response: reads come from r and
+// writes go to w, which CloseWrite closes.
+type fakeConn struct {
+	r io.Reader
+	w io.WriteCloser
+}
+
+// hijacked returns a hijacked response reading from r and writing to w, which
+// may be nil for a connection that is only read.
+func hijacked(r io.Reader, w io.WriteCloser) types.HijackedResponse {
+	return types.HijackedResponse{
+		Conn:   &fakeConn{r: r, w: w},
+		Reader: bufio.NewReader(r),
+	}
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	if c.w == nil {
+		return 0, errors.New("connection is read-only")
+	}
+	return c.w.Write(p)
+}
+
+func (c *fakeConn) CloseWrite() error {
+	if c.w == nil {
+		return nil
+	}
+	return c.w.Close()
+}
+
+func (c *fakeConn) Close() error {
+	c.CloseWrite()
+	if pr, ok := c.r.(*io.PipeReader); ok {
+		pr.Close()
+	}
+	return nil
+}
+
+func (c *fakeConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeConn) RemoteAddr() net.Addr               { return nil }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format writes a human-readable summary of res to w: the program's output,
+// followed by its exit code, timings and whatever cut the run short.
+func (res RunResult) Format(w io.Writer) error {
+	var b strings.Builder
+	if res.CompileStderr != "" {
+		fmt.Fprintf(&b, "COMPILE OUTPUT:\n%s\n", res.CompileStderr)
+	}
+	fmt.Fprintf(&b, "STDOUT:\n%s\n", res.Stdout)
+	fmt.Fprintf(&b, "STDERR:\n%s\n", res.Stderr)
+	if res.CompileFailed {
+		fmt.Fprintf(&b, "COMPILE FAILED: exit code %d\n", res.ExitCode)
+	} else {
+		fmt.Fprintf(&b, "EXIT CODE: %d\n", res.ExitCode)
+	}
+	fmt.Fprintf(&b, "TIME: %s wall, %s cpu\n", res.WallTime, res.CPUTime)
+	if err := res.Err(); err != nil {
+		fmt.Fprintf(&b, "KILLED: %s\n", err)
+	}
+	if res.OutputTruncated {
+		b.WriteString("TRUNCATED: output exceeded its limit\n")
+	}
+	if res.OutputFilesTruncated {
+		b.WriteString("TRUNCATED: output files exceeded their limit\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// String returns the summary written by Format.
+func (res RunResult) String() string {
+	var b strings.Builder
+	res.Format(&b)
+	return b.String()
+}
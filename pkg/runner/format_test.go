@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  RunResult
+		want    []string
+		missing []string
+	}{
+		{
+			name: "exited",
+			result: RunResult{
+				Stdout:   "hello\n",
+				Stderr:   "warning\n",
+				ExitCode: 3,
+				WallTime: 1500 * time.Millisecond,
+				CPUTime:  250 * time.Millisecond,
+			},
+			want:    []string{"STDOUT:\nhello\n", "STDERR:\nwarning\n", "EXIT CODE: 3\n", "TIME: 1.5s wall, 250ms cpu\n"},
+			missing: []string{"COMPILE", "KILLED", "TRUNCATED"},
+		},
+		{
+			name:    "cut short",
+			result:  RunResult{ExitCode: 137, TimedOut: true, OutputTruncated: true, OutputFilesTruncated: true},
+			want:    []string{"KILLED: " + ErrTimeout.Error(), "TRUNCATED: output exceeded", "TRUNCATED: output files exceeded"},
+			missing: []string{"COMPILE"},
+		},
+		{
+			name:    "compile failed",
+			result:  RunResult{CompileStderr: "main.c:1:1: error: oops\n", CompileFailed: true, ExitCode: 1},
+			want:    []string{"COMPILE OUTPUT:\nmain.c:1:1: error: oops\n", "COMPILE FAILED: exit code 1\n"},
+			missing: []string{"EXIT CODE"},
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := tt.result.Format(&b); err != nil {
+			t.Fatalf("%s: Format: %v", tt.name, err)
+		}
+		got := b.String()
+		for _, section := range tt.want {
+			if !strings.Contains(got, section) {
+				t.Errorf("%s: output %q lacks %q", tt.name, got, section)
+			}
+		}
+		for _, section := range tt.missing {
+			if strings.Contains(got, section) {
+				t.Errorf("%s: output %q holds %q", tt.name, got, section)
+			}
+		}
+		if s := tt.result.String(); s != got {
+			t.Errorf("%s: String() = %q, want the output of Format %q", tt.name, s, got)
+		}
+	}
+}
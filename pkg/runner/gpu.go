@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// deviceRequests returns the device requests for RunRequest.GPUs.
+func deviceRequests(gpus string) ([]container.DeviceRequest, error) {
+	if gpus == "" {
+		return nil, nil
+	}
+
+	count := -1 // all GPUs
+	if gpus != "all" {
+		n, err := strconv.Atoi(gpus)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf(`gpus %q is neither a positive count nor "all"`, gpus)
+		}
+		count = n
+	}
+
+	return []container.DeviceRequest{
+		{
+			Driver:       "nvidia",
+			Count:        count,
+			Capabilities: [][]string{{"gpu"}},
+		},
+	}, nil
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestRunGPUs(t *testing.T) {
+	tests := []struct {
+		gpus string
+		want []container.DeviceRequest
+	}{
+		{gpus: ""},
+		{gpus: "1", want: []container.DeviceRequest{{Driver: "nvidia", Count: 1, Capabilities: [][]string{{"gpu"}}}}},
+		{gpus: "all", want: []container.DeviceRequest{{Driver: "nvidia", Count: -1, Capabilities: [][]string{{"gpu"}}}}},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.GPUs = tt.gpus
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run with GPUs %q: %v", tt.gpus, err)
+		}
+		if got := fc.last().hostConfig.DeviceRequests; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GPUs %q: DeviceRequests = %+v, want %+v", tt.gpus, got, tt.want)
+		}
+	}
+}
+
+func TestRunGPUsRejects(t *testing.T) {
+	for _, gpus := range []string{"0", "-1", "two"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.GPUs = gpus
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted GPUs %q", gpus)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("GPUs %q: ContainerCreate called %d times, want 0", gpus, n)
+		}
+	}
+}
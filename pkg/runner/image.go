@@ -0,0 +1,273 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/archive"
+)
+
+// EnsureImage builds the runner image unless an image for the current build
+// context exists already, or pulls it when configured through WithPullImage,
+// without running anything. Calling it ahead of time, e.g. in CI, spares the
+// first run the build.
+func (r *Runner) EnsureImage(ctx context.Context) error {
+	_, err := r.ensureImage(ctx, defaultImage)
+	return err
+}
+
+// ensureImage returns the ID of the image tagged with name. The runner's own
+// image is tagged with the content hash of buildContext, so it is built first
+// whenever no image exists for the current contents of the build context. When
+// a pull image is configured, that one is pulled instead if it is missing.
+func (r *Runner) ensureImage(ctx context.Context, name string) (string, error) {
+	ref := name
+	switch {
+	case name != defaultImage:
+	case r.pullImage != "":
+		ref = r.pullImage
+	default:
+		if err := validateBuildContext(r.buildContext, r.dockerfile); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrImageBuild, err)
+		}
+		hash, err := contextHash(r.buildContext, r.dockerfile)
+		if err != nil {
+			return "", err
+		}
+		ref = name + ":" + hash
+	}
+
+	if r.pool != nil {
+		if imageID, ok := r.pool.image(ref); ok {
+			return imageID, nil
+		}
+	}
+
+	imageID, err := r.findImage(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if imageID != "" {
+		if r.pool != nil {
+			r.pool.cacheImage(ref, imageID)
+		}
+		return imageID, nil
+	}
+	if name != defaultImage {
+		return "", fmt.Errorf("%w: %s, pull it before running", ErrImageNotFound, name)
+	}
+	if r.pullImage != "" {
+		if err := r.pull(ctx, ref); err != nil {
+			return "", err
+		}
+		return r.foundImage(ctx, ref, ErrImagePull)
+	}
+
+	compression := archive.Uncompressed
+	if r.compressContext {
+		compression = archive.Gzip
+	}
+	tarfile, err := archive.TarWithOptions(r.buildContext, &archive.TarOptions{
+		Compression: compression,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrImageBuild, err)
+	}
+
+	resp, err := r.dc.ImageBuild(ctx,
+		tarfile,
+		types.ImageBuildOptions{
+			Tags:       []string{ref},
+			Dockerfile: r.dockerfile,
+			Remove:     true,
+			Labels:     map[string]string{labelCreatedBy: createdBy},
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrImageBuild, err)
+	}
+	defer resp.Body.Close()
+
+	if err := readProgress(resp.Body, r.buildOutput, ErrImageBuild); err != nil {
+		return "", err
+	}
+	return r.foundImage(ctx, ref, ErrImageBuild)
+}
+
+// pull pulls ref, streaming the progress to the build output.
+func (r *Runner) pull(ctx context.Context, ref string) error {
+	body, err := r.dc.ImagePull(ctx, ref, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrImagePull, err)
+	}
+	defer body.Close()
+
+	return readProgress(body, r.buildOutput, ErrImagePull)
+}
+
+// foundImage returns the ID of ref right after it was built or pulled,
+// reporting a missing image as kind.
+func (r *Runner) foundImage(ctx context.Context, ref string, kind error) (string, error) {
+	imageID, err := r.findImage(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if imageID == "" {
+		return "", fmt.Errorf("%w: image %s not found afterwards", kind, ref)
+	}
+	if r.pool != nil {
+		r.pool.cacheImage(ref, imageID)
+	}
+	return imageID, nil
+}
+
+// findImage returns the ID of the image matching ref, or an empty string when
+// there is none.
+func (r *Runner) findImage(ctx context.Context, ref string) (string, error) {
+	filters := filters.NewArgs(
+		filters.KeyValuePair{
+			Key:   "reference",
+			Value: ref,
+		},
+	)
+
+	result, err := r.dc.ImageList(
+		ctx,
+		types.ImageListOptions{
+			All:     true,
+			Filters: filters,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if len(result) == 0 {
+		return "", nil
+	}
+	return result[0].ID, nil
+}
+
+// validateBuildContext checks that dir is a directory containing the file
+// dockerfile.
+func validateBuildContext(dir, dockerfile string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("build context: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("build context %s is not a directory", dir)
+	}
+
+	info, err = os.Stat(filepath.Join(dir, dockerfile))
+	if err != nil {
+		return fmt.Errorf("build context %s: %w", dir, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("build context %s: %s is not a regular file", dir, dockerfile)
+	}
+	return nil
+}
+
+// contextHash returns a short hex digest over the name of the Dockerfile and
+// the paths, modes, sizes and contents of every file in dir. Identical build
+// contexts hash identically.
+func contextHash(dir, dockerfile string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", dockerfile)
+
+	err := filepath.WalkDir(dir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, pathname)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00%d\x00", filepath.ToSlash(rel), info.Mode(), info.Size())
+
+		fp, err := os.Open(pathname)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		_, err = io.Copy(h, fp)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("hash build context %s: %w", dir, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// progressMessage is a message of the ImageBuild or ImagePull response stream.
+type progressMessage struct {
+	Stream      string `json:"stream"`
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// readProgress consumes the ImageBuild or ImagePull response stream until the
+// build or pull finishes, copying the log to w when it is not nil. Progress bars
+// are left out of the log. A failure is returned as a kind error, i.e.
+// ErrImageBuild or ErrImagePull, carrying the log.
+func readProgress(r io.Reader, w io.Writer, kind error) error {
+	var buildLog strings.Builder
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg progressMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: read output: %w", kind, err)
+		}
+
+		line := msg.Stream
+		if msg.Status != "" && msg.Progress == "" {
+			line = msg.Status + "\n"
+			if msg.ID != "" {
+				line = msg.ID + ": " + line
+			}
+		}
+		if line != "" {
+			buildLog.WriteString(line)
+			if w != nil {
+				io.WriteString(w, line)
+			}
+		}
+
+		message := msg.Error
+		if msg.ErrorDetail != nil && msg.ErrorDetail.Message != "" {
+			message = msg.ErrorDetail.Message
+		}
+		if message != "" {
+			return fmt.Errorf("%w: %s\n%s", kind, message, buildLog.String())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package runner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBuildContext writes a build context with a Dockerfile holding
+// dockerfile to a new directory and returns it.
+func writeBuildContext(t *testing.T, dockerfile string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, defaultDockerfile), []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestEnsureImageTagsByContextHash(t *testing.T) {
+	fc := newFakeClient(t)
+	dir := writeBuildContext(t, "FROM ubuntu:22.04\n")
+	r := newTestRunner(fc, WithBuildContext(dir, ""))
+
+	for i := 0; i < 2; i++ {
+		if err := r.EnsureImage(context.Background()); err != nil {
+			t.Fatalf("EnsureImage: %v", err)
+		}
+	}
+	if fc.builds != 1 {
+		t.Fatalf("built %d times for an unchanged context, want 1", fc.builds)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, defaultDockerfile), []byte("FROM ubuntu:24.04\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnsureImage(context.Background()); err != nil {
+		t.Fatalf("EnsureImage: %v", err)
+	}
+	if fc.builds != 2 {
+		t.Fatalf("built %d times after changing the context, want 2", fc.builds)
+	}
+	first, second := fc.buildOptions[0].Tags[0], fc.buildOptions[1].Tags[0]
+	if first == second {
+		t.Errorf("both builds are tagged %s", first)
+	}
+}
+
+func TestContextHashIsStable(t *testing.T) {
+	a := writeBuildContext(t, "FROM ubuntu:22.04\n")
+	b := writeBuildContext(t, "FROM ubuntu:22.04\n")
+	hashA, err := contextHash(a, defaultDockerfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, err := contextHash(b, defaultDockerfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashA != hashB {
+		t.Errorf("identical contexts hash to %s and %s", hashA, hashB)
+	}
+}
+
+func TestEnsureImageBuildsOnce(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithBuildContext(writeBuildContext(t, "FROM ubuntu:22.04\n"), ""))
+
+	for i := 0; i < 2; i++ {
+		if err := r.EnsureImage(context.Background()); err != nil {
+			t.Fatalf("EnsureImage: %v", err)
+		}
+	}
+	if fc.builds != 1 {
+		t.Errorf("built %d times, want 1", fc.builds)
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+}
+
+func TestEnsureImageBuildFailure(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.buildBody = `{"stream":"Step 2/2 : RUN exit 3\n"}
+{"errorDetail":{"message":"The command '/bin/sh -c exit 3' returned a non-zero code: 3"},"error":"The command '/bin/sh -c exit 3' returned a non-zero code: 3"}`
+	var buildLog bytes.Buffer
+	r := newTestRunner(fc, WithBuildContext("testdata/failing-build", ""), WithBuildOutput(&buildLog))
+
+	err := r.EnsureImage(context.Background())
+	if !errors.Is(err, ErrImageBuild) {
+		t.Fatalf("EnsureImage error = %v, want ErrImageBuild", err)
+	}
+	if !strings.Contains(err.Error(), "non-zero code: 3") || !strings.Contains(err.Error(), "Step 2/2") {
+		t.Errorf("error %q lacks the failure or the build log", err)
+	}
+	if !strings.Contains(buildLog.String(), "Step 2/2") {
+		t.Errorf("build output = %q, want the build log", buildLog.String())
+	}
+}
+
+func TestEnsureImageBuildFailureDocker(t *testing.T) {
+	r := newDockerRunner(t, WithBuildContext("testdata/failing-build", ""))
+
+	if err := r.EnsureImage(context.Background()); !errors.Is(err, ErrImageBuild) {
+		t.Errorf("EnsureImage error = %v, want ErrImageBuild", err)
+	}
+}
+
+func TestEnsureImageAlternateContext(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithBuildContext("testdata/alt-context", "Runner.Dockerfile"))
+
+	req := fakeRequest()
+	req.Image = ""
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if fc.builds != 1 || fc.buildOptions[0].Dockerfile != "Runner.Dockerfile" {
+		t.Fatalf("built %d times with the options %+v, want one build of Runner.Dockerfile", fc.builds, fc.buildOptions)
+	}
+	_, contents := readTar(t, bytes.NewReader(fc.buildContexts[0]))
+	if _, ok := contents["marker.txt"]; !ok {
+		t.Error("the build context lacks marker.txt")
+	}
+	if got := fc.last().config.Image; got != "sha256:built1" {
+		t.Errorf("ran on the image %s, want the one just built", got)
+	}
+}
+
+func TestEnsureImageRejectsContextWithoutDockerfile(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithBuildContext("testdata/nested", ""))
+
+	if err := r.EnsureImage(context.Background()); !errors.Is(err, ErrImageBuild) {
+		t.Errorf("EnsureImage error = %v, want ErrImageBuild", err)
+	}
+	if fc.builds != 0 {
+		t.Errorf("built %d times, want 0", fc.builds)
+	}
+}
+
+func TestEnsureImageAlternateContextDocker(t *testing.T) {
+	r := newDockerRunner(t, WithBuildContext("testdata/alt-context", "Runner.Dockerfile"))
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("print(open('/marker.txt').read(), end='')\n")},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "alternate context\n" {
+		t.Errorf("Stdout = %q, want the marker of the alternate image", result.Stdout)
+	}
+}
+
+func TestEnsureImagePullsInsteadOfBuilding(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.pullBody = `{"status":"Pulling from runner","id":"1"}
+{"status":"Downloading","id":"layer","progress":"[==>   ]"}
+{"status":"Downloaded newer image for registry.example.com/runner:1"}`
+	var pullLog bytes.Buffer
+	r := newTestRunner(fc, WithPullImage("registry.example.com/runner:1"), WithBuildOutput(&pullLog))
+
+	req := fakeRequest()
+	req.Image = ""
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(fc.pulls) != 1 || fc.pulls[0] != "registry.example.com/runner:1" {
+		t.Errorf("pulled %v, want registry.example.com/runner:1 once", fc.pulls)
+	}
+	if n := fc.called("ImageBuild"); n != 0 {
+		t.Errorf("ImageBuild called %d times, want 0", n)
+	}
+	if got := fc.last().config.Image; got != "sha256:pulled" {
+		t.Errorf("ran on the image %s, want the one just pulled", got)
+	}
+	if want := "1: Pulling from runner\nDownloaded newer image for registry.example.com/runner:1\n"; pullLog.String() != want {
+		t.Errorf("pull output = %q, want %q", pullLog.String(), want)
+	}
+
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(fc.pulls) != 1 {
+		t.Errorf("pulled %d times, want the image to be pulled only while missing", len(fc.pulls))
+	}
+}
+
+func TestEnsureImageCompressedContext(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		fc := newFakeClient(t)
+		opts := []Option{WithBuildContext("testdata/alt-context", "Runner.Dockerfile")}
+		if compressed {
+			opts = append(opts, WithCompressedBuildContext())
+		}
+		r := newTestRunner(fc, opts...)
+
+		req := fakeRequest()
+		req.Image = ""
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("compressed %t: Run: %v", compressed, err)
+		}
+		if fc.builds != 1 {
+			t.Fatalf("compressed %t: built %d times, want 1", compressed, fc.builds)
+		}
+
+		var buildContext io.Reader = bytes.NewReader(fc.buildContexts[0])
+		if isGzip := bytes.HasPrefix(fc.buildContexts[0], []byte{0x1f, 0x8b}); isGzip != compressed {
+			t.Fatalf("compressed %t: the build context is gzip-framed %t", compressed, isGzip)
+		}
+		if compressed {
+			zr, err := gzip.NewReader(buildContext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buildContext = zr
+		}
+		_, contents := readTar(t, buildContext)
+		for _, name := range []string{"Runner.Dockerfile", "marker.txt"} {
+			if _, ok := contents[name]; !ok {
+				t.Errorf("compressed %t: the build context lacks %s", compressed, name)
+			}
+		}
+	}
+}
+
+func TestEnsureImageCompressedContextDocker(t *testing.T) {
+	r := newDockerRunner(t, WithBuildContext("testdata/alt-context", "Runner.Dockerfile"), WithCompressedBuildContext())
+
+	if err := r.EnsureImage(context.Background()); err != nil {
+		t.Fatalf("EnsureImage: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultLanguage = "python"
+
+// EntryPlaceholder is replaced in the arguments of Language.Cmd and
+// Language.CompileCmd with the file the program starts from, also within a
+// longer argument such as "-o{entry}".
+const EntryPlaceholder = "{entry}"
+
+// FilesPlaceholder is replaced in the arguments of Language.Cmd and
+// Language.CompileCmd with the submitted files that have the same extension
+// as the entry file, e.g. to compile all of a program's .c files but none of
+// its headers. An argument containing it is repeated once per file, so
+// "{files}" becomes the files themselves and "-i{files}" an -i argument for
+// each. Names are never split or interpreted by a shell.
+const FilesPlaceholder = "{files}"
+
+// Language describes how programs written in a language are run.
+type Language struct {
+	// Name identifies the language in RunRequest.Language.
+	Name string
+
+	// Image is the image programs run in. The runner's own image is built
+	// from its build context on demand, any other image must already be
+	// present on the daemon.
+	Image string
+
+	// Cmd runs the program from the working directory. It is wrapped by
+	// timer.sh unless the wrapper is disabled, see WithTimerScript.
+	// EntryPlaceholder is replaced with RunRequest.EntryFile, or MainFile if
+	// that is empty, and FilesPlaceholder with the matching submitted files.
+	Cmd []string
+
+	// CompileCmd, when set, builds the program from the working directory
+	// before Cmd runs, e.g. {"gcc", "-o", "main", FilesPlaceholder}. Cmd is skipped
+	// when it fails, see RunResult.CompileFailed. The image must let the user
+	// the program runs as write to the working directory. It is not run when
+	// RunRequest.Cmd overrides the command.
+	CompileCmd []string
+
+	// WorkDir is where the image expects the submission. Defaults to /code
+	// when empty.
+	WorkDir string
+
+	// MainFile is the file a submission is expected to start from unless
+	// RunRequest.EntryFile names another one.
+	MainFile string
+
+	// Diagnose, when set, parses the errors in the output of CompileCmd, or
+	// of Cmd otherwise, into RunResult.Diagnostics. workDir is the working
+	// directory the submission was run from.
+	Diagnose func(output, workDir string) []Diagnostic
+}
+
+var (
+	languagesMu sync.RWMutex
+	languages   = make(map[string]Language)
+)
+
+func init() {
+	RegisterLanguage(Language{
+		Name:     "python",
+		Image:    defaultImage,
+		Cmd:      []string{"python3", EntryPlaceholder},
+		MainFile: "main.py",
+		Diagnose: pythonDiagnostics,
+	})
+	RegisterLanguage(Language{
+		Name:     "node",
+		Image:    "node:20-alpine",
+		Cmd:      []string{"node", EntryPlaceholder},
+		MainFile: "main.js",
+	})
+	RegisterLanguage(Language{
+		Name:       "c",
+		Image:      "gcc:13",
+		CompileCmd: []string{"gcc", "-O2", "-o", "main", FilesPlaceholder, "-lm"},
+		Cmd:        []string{"./main"},
+		MainFile:   "main.c",
+		Diagnose:   gccDiagnostics,
+	})
+}
+
+// RegisterLanguage makes lang available to RunRequest.Language, replacing any
+// language previously registered under the same name.
+func RegisterLanguage(lang Language) {
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	languages[lang.Name] = lang
+}
+
+// LookupLanguage returns the language registered under name.
+func LookupLanguage(name string) (Language, error) {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	lang, ok := languages[name]
+	if !ok {
+		names := make([]string, 0, len(languages))
+		for n := range languages {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Language{}, fmt.Errorf("%w %q, expected one of: %s", ErrUnknownLanguage, name, strings.Join(names, ", "))
+	}
+	return lang, nil
+}
+
+// expandArgs returns a copy of args with EntryPlaceholder replaced by entry
+// and every argument containing FilesPlaceholder repeated for each of files.
+func expandArgs(args []string, entry string, files []string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		arg = strings.ReplaceAll(arg, EntryPlaceholder, entry)
+		if !strings.Contains(arg, FilesPlaceholder) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		for _, file := range files {
+			expanded = append(expanded, strings.ReplaceAll(arg, FilesPlaceholder, file))
+		}
+	}
+	return expanded
+}
+
+// DetectLanguage infers the language of a submission from the extensions of
+// its file names. Every file counts towards the registered languages whose
+// MainFile has the same extension, and the language with the most files wins.
+// It returns an error wrapping ErrUnknownLanguage when no file matches a
+// language, and ErrAmbiguousLanguage when several languages match equally
+// many files.
+func DetectLanguage(files map[string][]byte) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return detectLanguage(names)
+}
+
+// detectLanguage is DetectLanguage for a list of file names.
+func detectLanguage(names []string) (string, error) {
+	languagesMu.RLock()
+	byExt := make(map[string][]string)
+	for name, lang := range languages {
+		if ext := path.Ext(lang.MainFile); ext != "" {
+			byExt[ext] = append(byExt[ext], name)
+		}
+	}
+	languagesMu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, name := range names {
+		for _, lang := range byExt[path.Ext(name)] {
+			counts[lang]++
+		}
+	}
+
+	var (
+		best []string
+		most int
+	)
+	for lang, n := range counts {
+		switch {
+		case n > most:
+			best, most = []string{lang}, n
+		case n == most:
+			best = append(best, lang)
+		}
+	}
+	switch len(best) {
+	case 0:
+		return "", fmt.Errorf("%w: no file has the extension of a known language", ErrUnknownLanguage)
+	case 1:
+		return best[0], nil
+	}
+	sort.Strings(best)
+	return "", fmt.Errorf("%w: %s", ErrAmbiguousLanguage, strings.Join(best, ", "))
+}
@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunUnknownLanguage(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Language = "cobol"
+	_, err := r.Run(context.Background(), req)
+	if !errors.Is(err, ErrUnknownLanguage) {
+		t.Fatalf("Run error = %v, want ErrUnknownLanguage", err)
+	}
+	if !strings.Contains(err.Error(), "cobol") {
+		t.Errorf("error %q does not name the language", err)
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+}
+
+func TestRunEntryFile(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		// Run the entry file by printing it.
+		entry := c.config.Cmd[len(c.config.Cmd)-1]
+		return fakeExit{output: []fakeChunk{outChunk(string(c.files[entry]))}}
+	}
+	r := newTestRunner(fc)
+
+	files := map[string][]byte{
+		"app.py":    []byte("import helper\nprint('app')\n"),
+		"helper.py": []byte("print('helper')\n"),
+	}
+	for _, tt := range []struct {
+		entry string
+		want  string
+	}{
+		{entry: "app.py", want: "import helper\nprint('app')\n"},
+		{entry: "./helper.py", want: "print('helper')\n"},
+	} {
+		result, err := r.Run(context.Background(), RunRequest{
+			Image:       fakeImage,
+			SourceFiles: files,
+			EntryFile:   tt.entry,
+		})
+		if err != nil {
+			t.Fatalf("Run %s: %v", tt.entry, err)
+		}
+		if result.Stdout != tt.want {
+			t.Errorf("EntryFile %s: ran %q, want %q", tt.entry, result.Stdout, tt.want)
+		}
+	}
+}
+
+func TestRunEntryFileRejects(t *testing.T) {
+	for _, entry := range []string{"missing.py", "../main.py", "/code/main.py"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.EntryFile = entry
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted the entry file %s", entry)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", entry, n)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+		err   error
+	}{
+		{files: []string{"main.py", "util.py", "lib/helpers.py"}, want: "python"},
+		{files: []string{"main.py", "util.py", "README.md", "data.txt"}, want: "python"},
+		{files: []string{"main.js", "util.js", "check.py"}, want: "node"},
+		{files: []string{"main.py", "main.js"}, err: ErrAmbiguousLanguage},
+		{files: []string{"a.py", "b.py", "a.js", "b.js", "main.c"}, err: ErrAmbiguousLanguage},
+		{files: []string{"README.md"}, err: ErrUnknownLanguage},
+	}
+	for _, tt := range tests {
+		files := make(map[string][]byte, len(tt.files))
+		for _, name := range tt.files {
+			files[name] = nil
+		}
+		got, err := DetectLanguage(files)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("DetectLanguage(%v) = %q, %v, want %q, %v", tt.files, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRunDetectsLanguage(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.images[0].RepoTags = append(fc.images[0].RepoTags, "node:20-alpine")
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.js": []byte("console.log('hi')\n"), "util.js": nil},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if cmd := fc.last().config.Cmd; result.Language != "node" || cmd[len(cmd)-2] != "node" {
+		t.Errorf("ran %q as %s, want node detected", cmd, result.Language)
+	}
+
+	_, err = r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.js": nil, "main.py": nil},
+	})
+	if !errors.Is(err, ErrAmbiguousLanguage) {
+		t.Errorf("Run error = %v, want ErrAmbiguousLanguage", err)
+	}
+	if n := fc.called("ContainerCreate"); n != 1 {
+		t.Errorf("ContainerCreate called %d times, want only for the first run", n)
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	files := []string{"a.c", "b c.c"}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"python3", EntryPlaceholder}, want: []string{"python3", "main.py"}},
+		{args: []string{"-o{entry}"}, want: []string{"-omain.py"}},
+		{args: []string{"gcc", FilesPlaceholder, "-lm"}, want: []string{"gcc", "a.c", "b c.c", "-lm"}},
+		{args: []string{"-i{files}"}, want: []string{"-ia.c", "-ib c.c"}},
+	}
+	for _, tt := range tests {
+		if got := expandArgs(tt.args, "main.py", files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
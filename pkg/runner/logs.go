@@ -0,0 +1,358 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// followLogs follows the log stream of a started container until it stops.
+func followLogs(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	details bool,
+) (io.ReadCloser, error) {
+	return dc.ContainerLogs(
+		ctx,
+		containerID,
+		types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+			Details:    details,
+		},
+	)
+}
+
+// attachOutput attaches to the output of a container that has not started yet,
+// which is streamed in the same format as its logs until it stops.
+func attachOutput(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+) (io.ReadCloser, error) {
+	hr, err := dc.ContainerAttach(
+		ctx,
+		containerID,
+		types.ContainerAttachOptions{
+			Stream: true,
+			Stdout: true,
+			Stderr: true,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return hijackedReader{hr}, nil
+}
+
+// hijackedReader reads from a hijacked connection.
+type hijackedReader struct {
+	hr types.HijackedResponse
+}
+
+func (r hijackedReader) Read(p []byte) (int, error) {
+	return r.hr.Reader.Read(p)
+}
+
+func (r hijackedReader) Close() error {
+	r.hr.Close()
+	return nil
+}
+
+// readLogs copies a container log stream into stdout and stderr.
+//
+// Without a TTY the daemon multiplexes both streams, prefixing every frame
+// with an 8-byte header, which stdcopy strips while demultiplexing. With a TTY
+// the stream is raw and must be copied as is, since stdcopy would otherwise
+// misread program output as frame headers.
+func readLogs(r io.Reader, tty bool, stdout io.Writer, stderr io.Writer) error {
+	if tty {
+		_, err := io.Copy(stdout, r)
+		return err
+	}
+	_, err := stdcopy.StdCopy(stdout, stderr, r)
+	return err
+}
+
+// LogChunk is a piece of output in RunResult.CombinedLog.
+type LogChunk struct {
+	// Stream is "stdout" or "stderr". With RunRequest.Tty, all output is
+	// "stdout".
+	Stream string
+
+	// Offset is when the chunk was received, relative to when the run began
+	// collecting output, just before the program started.
+	Offset time.Duration
+
+	Data string
+}
+
+// combinedLog records the chunks written to its stream writers in the order
+// they arrive.
+type combinedLog struct {
+	start time.Time
+
+	mu     sync.Mutex
+	chunks []LogChunk
+}
+
+func newCombinedLog() *combinedLog {
+	return &combinedLog{start: time.Now()}
+}
+
+// Writer returns a writer recording chunks of stream.
+func (c *combinedLog) Writer(stream string) io.Writer {
+	return combinedWriter{log: c, stream: stream}
+}
+
+// Chunks returns the chunks recorded so far.
+func (c *combinedLog) Chunks() []LogChunk {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LogChunk(nil), c.chunks...)
+}
+
+type combinedWriter struct {
+	log    *combinedLog
+	stream string
+}
+
+func (w combinedWriter) Write(p []byte) (int, error) {
+	c := w.log
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chunks = append(c.chunks, LogChunk{
+		Stream: w.stream,
+		Offset: time.Since(c.start),
+		Data:   string(p),
+	})
+	return len(p), nil
+}
+
+// tailSize is how much of a stream that is not collected is kept anyway, to
+// find the timing line of the timer.sh wrapper in.
+const tailSize = 4096
+
+// tailBuffer keeps the last n bytes written to it.
+type tailBuffer struct {
+	n   int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.n {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.n:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// outputLimit enforces a byte budget shared by several writers. Output past
+// the budget is discarded and reported through Exceeded.
+type outputLimit struct {
+	mu        sync.Mutex
+	remaining int64
+	hit       bool
+	exceeded  chan struct{}
+	wrappers  []*limitedWriter
+}
+
+func newOutputLimit(n int64) *outputLimit {
+	return &outputLimit{
+		remaining: n,
+		exceeded:  make(chan struct{}),
+	}
+}
+
+// Writer returns a writer that forwards to w until the budget is spent.
+func (l *outputLimit) Writer(w io.Writer) io.Writer {
+	return &limitedWriter{w: w, limit: l}
+}
+
+// WrapperWriter is like Writer, for the stream the wrappers around the program
+// write to: the timing line of timer.sh and the compile markers do not count
+// towards the budget, so that it only covers the program's own output. Each
+// is let through once, and only up to maxWrapperLine bytes. The start of a
+// line that may still turn out to be one is held back until it is known, so
+// Flush must be called once the stream has ended.
+func (l *outputLimit) WrapperWriter(w io.Writer) io.Writer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lw := &limitedWriter{w: w, limit: l, lines: newWrapperLines()}
+	l.wrappers = append(l.wrappers, lw)
+	return lw
+}
+
+// Flush forwards the output the writers of WrapperWriter still hold back.
+func (l *outputLimit) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, lw := range l.wrappers {
+		held := lw.held
+		lw.held = nil
+		n := int64(len(held))
+		if n > l.remaining {
+			n = l.remaining
+			l.exceed()
+		}
+		if n > 0 {
+			if _, err := lw.w.Write(held[:n]); err != nil {
+				return err
+			}
+			l.remaining -= n
+		}
+	}
+	return nil
+}
+
+// Exceeded is closed once more output was written than the budget allows.
+func (l *outputLimit) Exceeded() <-chan struct{} {
+	return l.exceeded
+}
+
+// exceed records that the budget was exceeded. l.mu must be held.
+func (l *outputLimit) exceed() {
+	if !l.hit {
+		l.hit = true
+		close(l.exceeded)
+	}
+}
+
+type limitedWriter struct {
+	w     io.Writer
+	limit *outputLimit
+	// lines and held are only set for a WrapperWriter.
+	lines *wrapperLines
+	held  []byte
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	l := lw.limit
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out, charged, over := lw.fit(p, l.remaining)
+	if over {
+		l.exceed()
+	}
+	if len(out) > 0 {
+		if _, err := lw.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	l.remaining -= charged
+
+	// Report the whole chunk as written so the log copy keeps draining the
+	// stream instead of failing.
+	return len(p), nil
+}
+
+// fit returns the output to forward for p within remaining, how much of the
+// budget it takes and whether p went over it.
+func (lw *limitedWriter) fit(p []byte, remaining int64) ([]byte, int64, bool) {
+	if lw.lines == nil {
+		n := int64(len(p))
+		if n > remaining {
+			return p[:remaining], remaining, true
+		}
+		return p, n, false
+	}
+
+	data := append(lw.held[:len(lw.held):len(lw.held)], p...)
+	base := len(lw.held)
+	var charged int64
+	for i, b := range p {
+		c := lw.lines.charge(b)
+		if charged+c > remaining {
+			// The c bytes b settles end with b. Past the budget the
+			// output is cut short, so there are no lines to tell apart
+			// any more.
+			lw.lines, lw.held = nil, nil
+			return data[:base+i+1-int(c)], charged, true
+		}
+		charged += c
+	}
+	keep := len(data) - len(lw.lines.pending)
+	lw.held = append([]byte(nil), data[keep:]...)
+	return data[:keep], charged, false
+}
+
+// maxWrapperLine bounds the length of a line let through by WrapperWriter,
+// which a timing line or compile marker never comes close to.
+const maxWrapperLine = 128
+
+// wrapperPrefixes start the lines written by the wrappers.
+var wrapperPrefixes = []string{timingPrefix, compiledMarker, compileFailedMarker}
+
+// wrapperLines follows a stream byte by byte to tell the lines written by the
+// wrappers from the program's output.
+type wrapperLines struct {
+	lineStart bool
+	// pending holds the start of the current line while it may still be
+	// a wrapper line.
+	pending []byte
+	// left is how many bytes the current wrapper line may still take, or 0
+	// outside one.
+	left int
+	seen map[string]bool
+}
+
+func newWrapperLines() *wrapperLines {
+	return &wrapperLines{lineStart: true, seen: make(map[string]bool)}
+}
+
+// charge consumes b and returns how many bytes of the stream it settles as
+// the program's output: 0 while b may belong to a wrapper line, 1 for b
+// itself, or more once b shows that the line held back as pending is not a
+// wrapper line after all.
+func (w *wrapperLines) charge(b byte) int64 {
+	if w.left > 0 {
+		w.left--
+		if b == '\n' {
+			w.left = 0
+			w.lineStart = true
+		}
+		return 0
+	}
+	if !w.lineStart && len(w.pending) == 0 {
+		w.lineStart = b == '\n'
+		return 1
+	}
+
+	w.lineStart = false
+	w.pending = append(w.pending, b)
+	candidate := string(w.pending)
+	partial := false
+	for _, prefix := range wrapperPrefixes {
+		if w.seen[prefix] {
+			continue
+		}
+		if candidate == prefix {
+			w.seen[prefix] = true
+			w.pending = w.pending[:0]
+			w.left = maxWrapperLine - len(prefix)
+			return 0
+		}
+		if strings.HasPrefix(prefix, candidate) {
+			partial = true
+		}
+	}
+	if partial {
+		return 0
+	}
+	n := int64(len(w.pending))
+	w.pending = w.pending[:0]
+	w.lineStart = b == '\n'
+	return n
+}
@@ -0,0 +1,334 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunStripsLogHeaders(t *testing.T) {
+	for _, tty := range []bool{false, true} {
+		fc := newFakeClient(t)
+		fc.program = func(c *fakeContainer) fakeExit {
+			return fakeExit{output: []fakeChunk{outChunk("hello\n")}}
+		}
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Tty = tty
+		result, err := r.Run(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Tty=%t: Run: %v", tty, err)
+		}
+		if result.Stdout != "hello\n" {
+			t.Errorf("Tty=%t: Stdout = %q, want %q", tty, result.Stdout, "hello\n")
+		}
+	}
+}
+
+// stateWriter records the state of the fake container at every write.
+type stateWriter struct {
+	fc *fakeClient
+
+	mu     sync.Mutex
+	writes []string
+	states []string
+}
+
+func (w *stateWriter) Write(p []byte) (int, error) {
+	c := w.fc.last()
+	w.fc.mu.Lock()
+	state := c.state
+	w.fc.mu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, string(p))
+	w.states = append(w.states, state)
+	return len(p), nil
+}
+
+func TestRunStreamsOutput(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{
+			outChunk("one\n"),
+			{data: "two\n", delay: 50 * time.Millisecond},
+		}}
+	}
+	r := newTestRunner(fc)
+	w := &stateWriter{fc: fc}
+
+	req := fakeRequest()
+	req.Stdout = w
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(w.writes) != 2 || w.writes[0] != "one\n" || w.writes[1] != "two\n" {
+		t.Fatalf("writes = %q, want the two lines one by one", w.writes)
+	}
+	if w.states[0] != "running" {
+		t.Errorf("first line arrived once the program was %s, want it while running", w.states[0])
+	}
+	if result.Stdout != "one\ntwo\n" {
+		t.Errorf("Stdout = %q, want the buffered output as well", result.Stdout)
+	}
+}
+
+func TestRunOutputCap(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		// As good as printing forever: the program only stops once stopped.
+		chunks := make([]fakeChunk, 1000)
+		for i := range chunks {
+			chunks[i] = outChunk(strings.Repeat("y", 99) + "\n")
+		}
+		return fakeExit{output: chunks, hang: true}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.MaxOutputBytes = 1000
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.OutputTruncated {
+		t.Error("OutputTruncated = false, want true")
+	}
+	if n := len(result.Stdout); n != 1000 {
+		t.Errorf("Stdout is %d bytes, want the cap of 1000", n)
+	}
+	if n := fc.called("ContainerStop"); n == 0 {
+		t.Error("the program was not stopped")
+	}
+}
+
+func TestRunOutputAtCap(t *testing.T) {
+	const limit = 1000
+	out := strings.Repeat("y", limit-1) + "\n"
+	timing := timingPrefix + "0.50 0.20 0.05\n"
+	tests := []struct {
+		name      string
+		language  string
+		tty       bool
+		output    []fakeChunk
+		stdout    string
+		stderr    string
+		wallTime  time.Duration
+		truncated bool
+	}{
+		{name: "timed", output: []fakeChunk{outChunk(out), errChunk(timing)}, stdout: out, wallTime: 500 * time.Millisecond},
+		{name: "stderr", output: []fakeChunk{errChunk(out), errChunk(timing)}, stderr: out, wallTime: 500 * time.Millisecond},
+		{
+			name:     "split timing line",
+			output:   []fakeChunk{errChunk(out + "__RUNNER_TI"), errChunk("MING__ 0.50 0.20 0.05\n")},
+			stderr:   out,
+			wallTime: 500 * time.Millisecond,
+		},
+		{name: "tty", tty: true, output: []fakeChunk{outChunk(out), errChunk(timing)}, stdout: out, wallTime: 500 * time.Millisecond},
+		{
+			name:     "compiled",
+			language: "c",
+			output:   []fakeChunk{errChunk(compiledMarker + "\n"), outChunk(out), errChunk(timing)},
+			stdout:   out,
+			wallTime: 500 * time.Millisecond,
+		},
+		{
+			// The start of a line held back as it may be the wrapper's
+			// still counts, and is kept when the output ends with it.
+			name:   "lookalike",
+			output: []fakeChunk{errChunk(out[:limit-6] + "\n__RUN")},
+			stderr: out[:limit-6] + "\n__RUN",
+		},
+		{
+			name:      "over",
+			output:    []fakeChunk{outChunk(out + "y"), errChunk(timing)},
+			stdout:    out,
+			wallTime:  500 * time.Millisecond,
+			truncated: true,
+		},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		fc.images[0].RepoTags = append(fc.images[0].RepoTags, "gcc:13")
+		fc.program = func(c *fakeContainer) fakeExit {
+			return fakeExit{output: tt.output}
+		}
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		if tt.language != "" {
+			req = RunRequest{Language: tt.language, SourceFiles: map[string][]byte{"main.c": []byte("int main(void) { return 0; }\n")}}
+		}
+		req.Tty = tt.tty
+		req.MaxOutputBytes = limit
+		result, err := r.Run(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: Run: %v", tt.name, err)
+		}
+		if result.OutputTruncated != tt.truncated {
+			t.Errorf("%s: OutputTruncated = %t, want %t", tt.name, result.OutputTruncated, tt.truncated)
+		}
+		if n := fc.called("ContainerStop"); (n > 0) != tt.truncated {
+			t.Errorf("%s: ContainerStop called %d times, want a stop only when truncated", tt.name, n)
+		}
+		if result.Stdout != tt.stdout || result.Stderr != tt.stderr {
+			t.Errorf("%s: Stdout is %d bytes and Stderr %q, want %d bytes and %q", tt.name, len(result.Stdout), result.Stderr, len(tt.stdout), tt.stderr)
+		}
+		if result.WallTime != tt.wallTime {
+			t.Errorf("%s: WallTime = %s, want %s from the timing line beyond the cap", tt.name, result.WallTime, tt.wallTime)
+		}
+	}
+}
+
+func TestRunOutputWriters(t *testing.T) {
+	for _, streamOnly := range []bool{false, true} {
+		fc := newFakeClient(t)
+		fc.program = func(c *fakeContainer) fakeExit {
+			return fakeExit{output: []fakeChunk{
+				outChunk("out 1\n"),
+				errChunk("err 1\n"),
+				outChunk("out 2\n"),
+				errChunk("err 2\n"),
+			}}
+		}
+		r := newTestRunner(fc)
+
+		var stdout, stderr bytes.Buffer
+		req := fakeRequest()
+		req.Stdout = &stdout
+		req.Stderr = &stderr
+		req.StreamOnly = streamOnly
+		result, err := r.Run(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if stdout.String() != "out 1\nout 2\n" || stderr.String() != "err 1\nerr 2\n" {
+			t.Errorf("StreamOnly %t: writers got %q and %q, want the demuxed streams", streamOnly, stdout.String(), stderr.String())
+		}
+		wantStdout, wantStderr := stdout.String(), stderr.String()
+		if streamOnly {
+			wantStdout, wantStderr = "", ""
+		}
+		if result.Stdout != wantStdout || result.Stderr != wantStderr {
+			t.Errorf("StreamOnly %t: Stdout = %q, Stderr = %q, want %q and %q", streamOnly, result.Stdout, result.Stderr, wantStdout, wantStderr)
+		}
+	}
+}
+
+func TestRunTty(t *testing.T) {
+	// Bytes that would pass for a stdcopy header announcing a 5-byte stdout
+	// frame, were the stream demultiplexed.
+	header := "\x01\x00\x00\x00\x00\x00\x00\x05"
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		// A terminal carries both streams as one, with CRLF line endings.
+		return fakeExit{output: []fakeChunk{
+			outChunk("out\r\n" + header + "\r\n"),
+			errChunk("err\r\n"),
+			errChunk(timingPrefix + "0.50 0.20 0.05\r\n"),
+		}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Tty = true
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !fc.last().config.Tty {
+		t.Error("Config.Tty = false, want true")
+	}
+	if want := "out\n" + header + "\nerr\n"; result.Stdout != want || result.Stderr != "" {
+		t.Errorf("Stdout = %q, Stderr = %q, want all output as stdout %q", result.Stdout, result.Stderr, want)
+	}
+	if result.WallTime != 500*time.Millisecond {
+		t.Errorf("WallTime = %s, want the timing line taken from the terminal output", result.WallTime)
+	}
+}
+
+func TestRunCombinedLog(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{
+			outChunk("out 1\n"),
+			{data: "err 1\n", stderr: true, delay: 5 * time.Millisecond},
+			{data: "out 2\n", delay: 5 * time.Millisecond},
+			{data: "err 2\n", stderr: true, delay: 5 * time.Millisecond},
+		}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.CombinedLog = true
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []LogChunk{
+		{Stream: "stdout", Data: "out 1\n"},
+		{Stream: "stderr", Data: "err 1\n"},
+		{Stream: "stdout", Data: "out 2\n"},
+		{Stream: "stderr", Data: "err 2\n"},
+	}
+	if len(result.CombinedLog) != len(want) {
+		t.Fatalf("CombinedLog = %+v, want %d chunks", result.CombinedLog, len(want))
+	}
+	var last time.Duration
+	for i, chunk := range result.CombinedLog {
+		if chunk.Stream != want[i].Stream || chunk.Data != want[i].Data {
+			t.Errorf("chunk %d = %s %q, want %s %q", i, chunk.Stream, chunk.Data, want[i].Stream, want[i].Data)
+		}
+		if chunk.Offset < last {
+			t.Errorf("chunk %d at %s, before the previous one at %s", i, chunk.Offset, last)
+		}
+		last = chunk.Offset
+	}
+	if result.Stdout != "out 1\nout 2\n" || result.Stderr != "err 1\nerr 2\n" {
+		t.Errorf("Stdout = %q, Stderr = %q, want the streams kept apart as well", result.Stdout, result.Stderr)
+	}
+
+	// Without the option nothing is recorded.
+	result, err = r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.CombinedLog != nil {
+		t.Errorf("CombinedLog = %+v, want none unless requested", result.CombinedLog)
+	}
+}
+
+func TestRunCombinedLogDocker(t *testing.T) {
+	r := newDockerRunner(t, WithTimerScript(""))
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte(`import sys, time
+for i in range(3):
+    print("out", i, flush=True)
+    time.sleep(0.05)
+    print("err", i, file=sys.stderr, flush=True)
+    time.sleep(0.05)
+`),
+		},
+		CombinedLog: true,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var got []string
+	for _, chunk := range result.CombinedLog {
+		got = append(got, chunk.Stream+" "+chunk.Data)
+	}
+	want := "stdout out 0\nstderr err 0\nstdout out 1\nstderr err 1\nstdout out 2\nstderr err 2\n"
+	if strings.Join(got, "") != want {
+		t.Errorf("CombinedLog = %q, want the writes in order", got)
+	}
+}
@@ -0,0 +1,33 @@
+package runner
+
+import "time"
+
+// Metrics receives events of every run, e.g. to export them to Prometheus.
+// Implementations must be safe for concurrent use. A Prometheus adapter would
+// count runs in RunStarted, and in RunFinished successful runs (err is nil),
+// timeouts (result.TimedOut), OOM kills (result.OOMKilled) and observe d in a
+// histogram.
+type Metrics interface {
+	// RunStarted is called when a run of language starts.
+	RunStarted(language string)
+
+	// RunFinished is called when the run of language is over, with what Run
+	// returns and the wall-clock time it took.
+	RunFinished(language string, result RunResult, err error, d time.Duration)
+}
+
+// noMetrics discards all events.
+type noMetrics struct{}
+
+func (noMetrics) RunStarted(string)                                   {}
+func (noMetrics) RunFinished(string, RunResult, error, time.Duration) {}
+
+// WithMetrics reports the events of every run to m. A nil m disables metrics.
+func WithMetrics(m Metrics) Option {
+	return func(r *Runner) {
+		if m == nil {
+			m = noMetrics{}
+		}
+		r.metrics = m
+	}
+}
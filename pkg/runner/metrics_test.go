@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMetrics counts runs the way a Prometheus adapter would.
+type countingMetrics struct {
+	mu                                     sync.Mutex
+	started, succeeded, timeouts, oomKills int
+	durations                              []time.Duration
+}
+
+func (m *countingMetrics) RunStarted(language string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started++
+}
+
+func (m *countingMetrics) RunFinished(language string, result RunResult, err error, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.succeeded++
+	}
+	if result.TimedOut {
+		m.timeouts++
+	}
+	if result.OOMKilled {
+		m.oomKills++
+	}
+	m.durations = append(m.durations, d)
+}
+
+func TestRunMetrics(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		switch c.config.Labels[labelRequestID] {
+		case "timeout":
+			return fakeExit{hang: true}
+		case "oom":
+			return fakeExit{code: 137, oomKilled: true}
+		}
+		return fakeExit{}
+	}
+	var m countingMetrics
+	r := newTestRunner(fc, WithMetrics(&m))
+
+	for _, id := range []string{"ok", "timeout", "oom"} {
+		req := fakeRequest()
+		req.RequestID = id
+		req.Timeout = 100 * time.Millisecond
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run %s: %v", id, err)
+		}
+	}
+	req := fakeRequest()
+	req.Language = "cobol"
+	if _, err := r.Run(context.Background(), req); err == nil {
+		t.Fatal("Run of an unknown language succeeded")
+	}
+
+	if m.started != 4 || m.succeeded != 3 || m.timeouts != 1 || m.oomKills != 1 {
+		t.Errorf("started %d, succeeded %d, timed out %d, OOM killed %d, want 4, 3, 1 and 1", m.started, m.succeeded, m.timeouts, m.oomKills)
+	}
+	if len(m.durations) != 4 || m.durations[1] < req.Timeout {
+		t.Errorf("durations = %v, want one per run with the timeout's at least %v", m.durations, req.Timeout)
+	}
+}
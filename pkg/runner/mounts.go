@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// Mount makes a file or directory of the host available to the program, e.g.
+// a fixed dataset that would be wasteful to pack into every submission.
+type Mount struct {
+	// Source is the path on the host. It must exist.
+	Source string
+
+	// Target is the absolute path inside the container.
+	Target string
+
+	// Writable lets the program modify Source. Mounts are read-only by
+	// default, and system paths of the host can only ever be mounted
+	// read-only.
+	Writable bool
+}
+
+// sensitivePaths are host paths that are never mounted writable, and neither
+// is anything below them or any directory containing them.
+var sensitivePaths = []string{
+	"/",
+	"/bin",
+	"/boot",
+	"/dev",
+	"/etc",
+	"/home",
+	"/lib",
+	"/proc",
+	"/root",
+	"/run",
+	"/sbin",
+	"/sys",
+	"/usr",
+	"/var/lib/docker",
+	"/var/run",
+}
+
+// inputMounts validates mounts and turns them into bind mounts. Targets may
+// neither be the working directory workDir nor contain it, as the submission
+// is copied there.
+func inputMounts(mounts []Mount, workDir string) ([]mount.Mount, error) {
+	result := make([]mount.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		source, err := filepath.Abs(m.Source)
+		if err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Source, err)
+		}
+		if source, err = filepath.EvalSymlinks(source); err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Source, err)
+		}
+		if _, err := os.Stat(source); err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Source, err)
+		}
+		if m.Writable && isSensitivePath(source) {
+			return nil, fmt.Errorf("mount %s: %s may only be mounted read-only", m.Source, source)
+		}
+
+		if !path.IsAbs(m.Target) {
+			return nil, fmt.Errorf("mount %s: target %s is not absolute", m.Source, m.Target)
+		}
+		target := path.Clean(m.Target)
+		if target == workDir || isWithin(workDir, target) {
+			return nil, fmt.Errorf("mount %s: target %s would hide the working directory %s", m.Source, target, workDir)
+		}
+
+		result = append(result, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   source,
+			Target:   target,
+			ReadOnly: !m.Writable,
+		})
+	}
+	return result, nil
+}
+
+// isSensitivePath reports whether the host path p is one of sensitivePaths,
+// lies below one or contains one, as /var contains /var/lib/docker. Every
+// path lies below "/", so that one only matches itself.
+func isSensitivePath(p string) bool {
+	p = filepath.ToSlash(p)
+	for _, s := range sensitivePaths {
+		if p == s || (s != "/" && isWithin(p, s)) || isWithin(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether the slash-separated path p lies below dir.
+func isWithin(p, dir string) bool {
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// writeDataFile writes a data file to a new directory and returns its path.
+func writeDataFile(t *testing.T) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(name, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRunInputMounts(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+	data := writeDataFile(t)
+
+	req := fakeRequest()
+	req.InputMounts = []Mount{{Source: data, Target: "/data/data.txt"}}
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var found bool
+	for _, m := range fc.last().hostConfig.Mounts {
+		if m.Target == "/data/data.txt" {
+			found = true
+			source, _ := filepath.EvalSymlinks(data)
+			if m.Type != mount.TypeBind || m.Source != source || !m.ReadOnly {
+				t.Errorf("mount = %+v, want a read-only bind mount of %s", m, source)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Mounts = %+v, want /data/data.txt", fc.last().hostConfig.Mounts)
+	}
+}
+
+func TestInputMountsRejects(t *testing.T) {
+	data := writeDataFile(t)
+	for _, m := range []Mount{
+		{Source: filepath.Join(t.TempDir(), "missing"), Target: "/data"},
+		{Source: "/etc", Target: "/data", Writable: true},
+		{Source: "/var", Target: "/data", Writable: true},
+		{Source: data, Target: "data.txt"},
+		{Source: data, Target: codeDir},
+		{Source: data, Target: "/"},
+	} {
+		if _, err := inputMounts([]Mount{m}, codeDir); err == nil {
+			t.Errorf("inputMounts accepted %+v", m)
+		}
+	}
+	if _, err := inputMounts([]Mount{{Source: "/etc", Target: "/data"}}, codeDir); err != nil {
+		t.Errorf("inputMounts rejected /etc mounted read-only: %v", err)
+	}
+}
+
+func TestRunInputMountsDocker(t *testing.T) {
+	r := newDockerRunner(t)
+	data := writeDataFile(t)
+
+	source := `
+print(open("/data/data.txt").read(), end="")
+try:
+    open("/data/data.txt", "w").write("x")
+    print("modified")
+except OSError:
+    print("read-only")
+`
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte(source)},
+		InputMounts: []Mount{{Source: data, Target: "/data/data.txt"}},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := "42\nread-only\n"; result.Stdout != want {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, want)
+	}
+}
@@ -0,0 +1,20 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// networkMode returns the network mode for RunRequest.Network, rejecting
+// modes that would share a network stack with the host or another container.
+func networkMode(network string) (container.NetworkMode, error) {
+	mode := container.NetworkMode(network)
+	switch {
+	case network == "":
+		return "none", nil
+	case mode.IsHost(), mode.IsContainer():
+		return "", fmt.Errorf("network %q is not allowed, use a bridge or user-defined network", network)
+	}
+	return mode, nil
+}
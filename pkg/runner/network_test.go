@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestRunNetwork(t *testing.T) {
+	tests := []struct {
+		network  string
+		mode     container.NetworkMode
+		disabled bool
+	}{
+		{network: "", mode: "none", disabled: true},
+		{network: "none", mode: "none", disabled: true},
+		{network: "bridge", mode: "bridge"},
+		{network: "grading-mocks", mode: "grading-mocks"},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Network = tt.network
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run on the network %q: %v", tt.network, err)
+		}
+		c := fc.last()
+		if c.hostConfig.NetworkMode != tt.mode || c.config.NetworkDisabled != tt.disabled {
+			t.Errorf("network %q: NetworkMode = %s, NetworkDisabled = %t, want %s and %t",
+				tt.network, c.hostConfig.NetworkMode, c.config.NetworkDisabled, tt.mode, tt.disabled)
+		}
+	}
+}
+
+func TestRunNetworkRejectsSharedStacks(t *testing.T) {
+	for _, network := range []string{"host", "container:other"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Network = network
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted the network %q", network)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%s: ContainerCreate called %d times, want 0", network, n)
+		}
+	}
+}
+
+func TestRunNetworkDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	// The loopback interface is all there is without networking.
+	code := []byte("import os\nprint(sorted(os.listdir('/sys/class/net')) != ['lo'])\n")
+	for _, tt := range []struct {
+		network string
+		want    string
+	}{
+		{network: "", want: "False\n"},
+		{network: "bridge", want: "True\n"},
+	} {
+		result, err := r.Run(context.Background(), RunRequest{
+			SourceFiles: map[string][]byte{"main.py": code},
+			Network:     tt.network,
+		})
+		if err != nil {
+			t.Fatalf("Run on the network %q: %v", tt.network, err)
+		}
+		if result.Stdout != tt.want {
+			t.Errorf("network %q: has a network interface = %q, want %q", tt.network, result.Stdout, tt.want)
+		}
+	}
+}
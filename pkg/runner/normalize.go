@@ -0,0 +1,18 @@
+package runner
+
+import "strings"
+
+// normalizeOutput converts CRLF line endings in s to LF and, if trimTrailing is
+// set, strips trailing spaces and tabs from every line.
+func normalizeOutput(s string, trimTrailing bool) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !trimTrailing {
+		return s
+	}
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
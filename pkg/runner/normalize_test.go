@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		in   string
+		trim bool
+		want string
+	}{
+		{in: "a\r\nb\nc\r\n", want: "a\nb\nc\n"},
+		{in: "a  \r\nb\t\nc \r\n", want: "a  \nb\t\nc \n"},
+		{in: "a  \r\nb\t\nc \r\n", trim: true, want: "a\nb\nc\n"},
+		{in: "lone\rcarriage return", want: "lone\rcarriage return"},
+	}
+	for _, tt := range tests {
+		if got := normalizeOutput(tt.in, tt.trim); got != tt.want {
+			t.Errorf("normalizeOutput(%q, %t) = %q, want %q", tt.in, tt.trim, got, tt.want)
+		}
+	}
+}
+
+func TestRunNormalizeOutput(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk("a \r\nb\n")}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.NormalizeOutput = true
+	req.TrimTrailingSpace = true
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "a\nb\n" || result.RawStdout != "a \r\nb\n" {
+		t.Errorf("Stdout = %q, RawStdout = %q, want %q and the raw output", result.Stdout, result.RawStdout, "a\nb\n")
+	}
+}
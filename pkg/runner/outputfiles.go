@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/docker/docker/errdefs"
+)
+
+// outputFiles copies the files and directories at paths, relative to workDir,
+// out of the stopped container. Their regular files are returned keyed by
+// their path relative to workDir. Paths the program did not create are left
+// out. Once maxBytes have been copied, the remaining files are left out too
+// and truncated is set.
+func outputFiles(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+	workDir string,
+	paths []string,
+	maxBytes int64,
+) (files map[string][]byte, truncated bool, err error) {
+	files = make(map[string][]byte)
+	remaining := maxBytes
+
+	for _, p := range paths {
+		rc, _, err := dc.CopyFromContainer(ctx, containerID, path.Join(workDir, p))
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("copy output file %s: %w", p, err)
+		}
+
+		// Entries are named relative to the parent of the copied path.
+		dir := path.Dir(p)
+		tr := tar.NewReader(rc)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rc.Close()
+				return nil, false, fmt.Errorf("copy output file %s: %w", p, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if header.Size > remaining {
+				truncated = true
+				continue
+			}
+
+			name, err := validateSourcePath(path.Join(dir, header.Name))
+			if err != nil {
+				rc.Close()
+				return nil, false, err
+			}
+			b, err := io.ReadAll(io.LimitReader(tr, header.Size))
+			if err != nil {
+				rc.Close()
+				return nil, false, fmt.Errorf("copy output file %s: %w", name, err)
+			}
+			remaining -= int64(len(b))
+			files[name] = b
+		}
+		rc.Close()
+	}
+
+	return files, truncated, nil
+}
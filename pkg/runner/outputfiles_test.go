@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunOutputFiles(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{files: map[string]string{
+			"out.txt":        "42\n",
+			"results/a.json": `{"a": 1}`,
+			"results/b.json": `{"b": 2}`,
+			"scratch.txt":    "not asked for",
+		}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.OutputFiles = []string{"out.txt", "results", "missing.txt"}
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string][]byte{
+		"out.txt":        []byte("42\n"),
+		"results/a.json": []byte(`{"a": 1}`),
+		"results/b.json": []byte(`{"b": 2}`),
+	}
+	if !reflect.DeepEqual(result.OutputFiles, want) || result.OutputFilesTruncated {
+		t.Errorf("OutputFiles = %q, truncated %t, want %q", result.OutputFiles, result.OutputFilesTruncated, want)
+	}
+}
+
+func TestRunOutputFilesCap(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{files: map[string]string{"a.txt": "12345", "b.txt": "67890"}}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.OutputFiles = []string{"a.txt", "b.txt"}
+	req.MaxOutputFileBytes = 8
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.OutputFiles) != 1 || string(result.OutputFiles["a.txt"]) != "12345" || !result.OutputFilesTruncated {
+		t.Errorf("OutputFiles = %q, truncated %t, want only a.txt and truncated", result.OutputFiles, result.OutputFilesTruncated)
+	}
+}
+
+func TestRunOutputFilesRejects(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/etc/passwd", ""} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.OutputFiles = []string{p}
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted the output file %q", p)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%q: ContainerCreate called %d times, want 0", p, n)
+		}
+	}
+}
+
+func TestRunOutputFilesDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("open('/code/out.txt', 'w').write('42\\n')\n")},
+		OutputFiles: []string{"out.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := string(result.OutputFiles["out.txt"]); got != "42\n" {
+		t.Errorf("out.txt = %q, want %q", got, "42\n")
+	}
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// WithPool makes the Runner keep up to size containers created ahead of time
+// for every container configuration it has run, so that later runs with the
+// same configuration skip ContainerCreate. Resolved image IDs are cached as
+// well, skipping the ImageList lookup.
+//
+// Containers are kept for the maxPoolConfigs most recently used
+// configurations only, so at most that many times size containers are idle
+// at once. The idle containers of the least recently used configuration are
+// removed when another one comes along, and Shutdown and Close remove all of
+// them and stop refilling.
+//
+// A pooled container still serves a single run. Once a program has run, its
+// processes and /code cannot be reset reliably, so the container is removed
+// as usual and the pool is refilled in the background instead.
+func WithPool(size int) Option {
+	return func(r *Runner) {
+		r.pool = &containerPool{
+			size:    size,
+			idle:    make(map[string][]string),
+			filling: make(map[string]bool),
+			images:  make(map[string]string),
+		}
+	}
+}
+
+// maxPoolConfigs is the number of container configurations a pool keeps idle
+// containers for.
+const maxPoolConfigs = 8
+
+// containerPool holds created but never started containers, grouped by the
+// configuration they were created with.
+type containerPool struct {
+	size int
+
+	mu      sync.Mutex
+	idle    map[string][]string
+	filling map[string]bool
+	images  map[string]string
+	closed  bool
+
+	// keys lists the configurations kept in idle, least recently used
+	// first.
+	keys []string
+}
+
+// poolKey identifies containers that were created with the same
+// configuration and can therefore stand in for each other.
+func poolKey(config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	b, err := json.Marshal(struct {
+		Config     *container.Config
+		HostConfig *container.HostConfig
+	}{config, hostConfig})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// take returns an idle container matching config and hostConfig, creating
+// one when there is none, and refills the pool in the background. Idle
+// containers that are no longer in the created state are evicted.
+func (p *containerPool) take(
+	ctx context.Context,
+	r *Runner,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+) (string, error) {
+	key, err := poolKey(config, hostConfig)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	evicted := p.use(key)
+	p.mu.Unlock()
+	if len(evicted) > 0 {
+		go r.disposeAll(evicted)
+	}
+	defer p.refill(r, key, config, hostConfig)
+
+	for {
+		p.mu.Lock()
+		ids := p.idle[key]
+		if len(ids) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		id := ids[len(ids)-1]
+		p.idle[key] = ids[:len(ids)-1]
+		p.mu.Unlock()
+
+		info, err := r.dc.ContainerInspect(ctx, id)
+		if err == nil && info.State != nil && info.State.Status == "created" {
+			return id, nil
+		}
+		r.dispose(ctx, id)
+	}
+
+	return r.newContainer(ctx, config, hostConfig)
+}
+
+// refill tops up the idle containers for key to the pool size in the
+// background. Only one refill runs per key at a time, and a failing create
+// simply leaves the pool short.
+func (p *containerPool) refill(
+	r *Runner,
+	key string,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+) {
+	p.mu.Lock()
+	if p.closed || p.filling[key] {
+		p.mu.Unlock()
+		return
+	}
+	p.filling[key] = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.filling, key)
+			p.mu.Unlock()
+		}()
+
+		ctx := context.Background()
+		for {
+			p.mu.Lock()
+			full := !p.wants(key) || len(p.idle[key]) >= p.size
+			p.mu.Unlock()
+			if full {
+				return
+			}
+
+			id, err := r.newContainer(ctx, config, hostConfig)
+			if err != nil {
+				return
+			}
+
+			p.mu.Lock()
+			wanted := p.wants(key)
+			if wanted {
+				p.idle[key] = append(p.idle[key], id)
+			}
+			p.mu.Unlock()
+			if !wanted {
+				r.disposeAll([]string{id})
+				return
+			}
+		}
+	}()
+}
+
+// use marks key as the most recently used configuration and evicts the least
+// recently used one if that makes too many, returning its idle containers for
+// removal. p.mu must be held.
+func (p *containerPool) use(key string) []string {
+	for i, k := range p.keys {
+		if k == key {
+			p.keys = append(p.keys[:i], p.keys[i+1:]...)
+			break
+		}
+	}
+	p.keys = append(p.keys, key)
+	if len(p.keys) <= maxPoolConfigs {
+		return nil
+	}
+
+	oldest := p.keys[0]
+	p.keys = p.keys[1:]
+	evicted := p.idle[oldest]
+	delete(p.idle, oldest)
+	return evicted
+}
+
+// wants reports whether idle containers are still kept for key, which stops
+// being the case once it is evicted or the pool is drained. p.mu must be
+// held.
+func (p *containerPool) wants(key string) bool {
+	if p.closed {
+		return false
+	}
+	for _, k := range p.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// image returns the cached image ID for ref.
+func (p *containerPool) image(ref string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.images[ref]
+	return id, ok
+}
+
+// cacheImage remembers the image ID resolved for ref.
+func (p *containerPool) cacheImage(ref string, id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.images[ref] = id
+}
+
+// drain forgets all idle containers, leaving their removal to the caller, and
+// stops refilling for good. Containers a refill creates afterwards are
+// removed right away.
+func (p *containerPool) drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = make(map[string][]string)
+	p.keys = nil
+	p.closed = true
+}
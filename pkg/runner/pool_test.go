@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitCreated waits until fc has created n containers.
+func waitCreated(t testing.TB, fc *fakeClient, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fc.mu.Lock()
+		created := len(fc.created)
+		fc.mu.Unlock()
+		if created >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("created %d containers, want %d", created, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolReusesIdleContainer(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithPool(1))
+	defer r.Close()
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	waitCreated(t, fc, 2)
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.starts) != 2 || fc.starts[1] != "container2" {
+		t.Errorf("started %v, want the second run to take the pooled container2", fc.starts)
+	}
+}
+
+// benchmarkRun runs a program taking 5ms on a daemon taking as long to create
+// a container.
+func benchmarkRun(b *testing.B, opts ...Option) {
+	fc := newFakeClient(b)
+	fc.createDelay = 5 * time.Millisecond
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{{data: "done\n", delay: 5 * time.Millisecond}}}
+	}
+	r := newTestRunner(fc, opts...)
+	defer r.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunWithoutPool(b *testing.B) {
+	benchmarkRun(b)
+}
+
+func BenchmarkRunWithPool(b *testing.B) {
+	benchmarkRun(b, WithPool(2))
+}
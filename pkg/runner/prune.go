@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+// PruneReport lists what Prune removed.
+type PruneReport struct {
+	// Containers and Images hold the IDs of the removed containers and
+	// images.
+	Containers []string
+	Images     []string
+}
+
+// Prune removes the containers and images carrying the runner's created-by
+// label that were created more than olderThan ago, e.g. those left behind by
+// crashed processes or earlier versions of the build context. Containers of
+// runs still in progress on r, the image of the current build context and
+// images still used by a container are kept. Unlike Cleanup, Prune is safe to
+// call periodically while other runners share the daemon, as long as no run
+// takes longer than olderThan.
+func (r *Runner) Prune(ctx context.Context, olderThan time.Duration) (PruneReport, error) {
+	var (
+		report PruneReport
+		errs   []error
+		cutoff = time.Now().Add(-olderThan).Unix()
+		label  = filters.NewArgs(filters.Arg("label", labelCreatedBy+"="+createdBy))
+	)
+
+	containers, err := r.dc.ContainerList(
+		ctx,
+		types.ContainerListOptions{
+			All:     true,
+			Filters: label,
+		},
+	)
+	if err != nil {
+		return report, err
+	}
+	for _, c := range containers {
+		if c.Created >= cutoff || r.isLive(c.ID) {
+			continue
+		}
+		if err := r.dispose(ctx, c.ID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report.Containers = append(report.Containers, c.ID)
+	}
+
+	images, err := r.dc.ImageList(
+		ctx,
+		types.ImageListOptions{
+			All:     true,
+			Filters: label,
+		},
+	)
+	if err != nil {
+		return report, errors.Join(append(errs, err)...)
+	}
+	current := r.currentImageRef()
+	for _, img := range images {
+		if img.Created >= cutoff || hasTag(img.RepoTags, current) {
+			continue
+		}
+		_, err := r.dc.ImageRemove(
+			ctx,
+			img.ID,
+			types.ImageRemoveOptions{
+				PruneChildren: true,
+			},
+		)
+		if errdefs.IsConflict(err) {
+			// Still used by a container.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report.Images = append(report.Images, img.ID)
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// isLive reports whether containerID was created by r and not disposed yet.
+func (r *Runner) isLive(containerID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.live[containerID]
+	return ok
+}
+
+// currentImageRef returns the reference the runner image is built as for the
+// current build context, or an empty string when it cannot be determined.
+func (r *Runner) currentImageRef() string {
+	hash, err := contextHash(r.buildContext, r.dockerfile)
+	if err != nil {
+		return ""
+	}
+	return defaultImage + ":" + hash
+}
+
+// hasTag reports whether tag is among tags.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if tag != "" && t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestPrune(t *testing.T) {
+	var (
+		ours   = map[string]string{labelCreatedBy: createdBy}
+		old    = time.Now().Add(-2 * time.Hour).Unix()
+		recent = time.Now().Add(-time.Minute).Unix()
+	)
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithBuildContext(writeBuildContext(t, "FROM ubuntu:22.04\n"), ""))
+
+	fc.listed = []types.Container{
+		{ID: "old", Created: old, Labels: ours},
+		{ID: "recent", Created: recent, Labels: ours},
+		{ID: "in-progress", Created: old, Labels: ours},
+		{ID: "unrelated", Created: old, Labels: map[string]string{labelCreatedBy: "someone-else"}},
+	}
+	r.track("in-progress")
+	fc.images = append(fc.images,
+		types.ImageSummary{ID: "sha256:old", Created: old, Labels: ours, RepoTags: []string{defaultImage + ":0123"}},
+		types.ImageSummary{ID: "sha256:recent", Created: recent, Labels: ours},
+		types.ImageSummary{ID: "sha256:current", Created: old, Labels: ours, RepoTags: []string{r.currentImageRef()}},
+		types.ImageSummary{ID: "sha256:unrelated", Created: old},
+	)
+
+	report, err := r.Prune(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	want := PruneReport{Containers: []string{"old"}, Images: []string{"sha256:old"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Prune = %+v, want %+v", report, want)
+	}
+	if !reflect.DeepEqual(fc.removes, want.Containers) || !reflect.DeepEqual(fc.removedImages, want.Images) {
+		t.Errorf("removed the containers %v and images %v, want %+v", fc.removes, fc.removedImages, want)
+	}
+}
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryDelay    = 100 * time.Millisecond
+)
+
+// retryPolicy retries Docker calls failing with transient errors.
+type retryPolicy struct {
+	// attempts is the maximum number of calls made, including the first.
+	attempts int
+
+	// baseDelay is the pause before the first retry. It doubles with every
+	// retry after that.
+	baseDelay time.Duration
+}
+
+// WithRetry makes the Runner try creating and starting containers up to
+// attempts times when the daemon fails with a transient error, such as a
+// refused connection while it restarts. Retries back off exponentially,
+// starting at baseDelay. Defaults to 3 attempts starting at 100ms; attempts
+// of 1 disables retries.
+func WithRetry(attempts int, baseDelay time.Duration) Option {
+	return func(r *Runner) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		r.retry = retryPolicy{
+			attempts:  attempts,
+			baseDelay: baseDelay,
+		}
+	}
+}
+
+// do calls fn until it succeeds, fails with an error that retryable rejects,
+// the attempts are used up or ctx is done. It returns the last error of fn.
+func (p retryPolicy) do(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	delay := p.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.attempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// transient reports whether err is an error of the daemon that may go away by
+// itself: an unreachable daemon or one reporting itself unavailable.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return client.IsErrConnectionFailed(err) || errdefs.IsUnavailable(err)
+}
+
+// transientCreate reports whether a failed ContainerCreate may succeed when
+// retried. On top of transient errors, that includes naming conflicts, as
+// every attempt picks a new name.
+func transientCreate(err error) bool {
+	return transient(err) || errdefs.IsConflict(err)
+}
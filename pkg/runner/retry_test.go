@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+)
+
+func TestRunRetriesTransientErrors(t *testing.T) {
+	unavailable := errdefs.Unavailable(errors.New("daemon restarting"))
+	fc := newFakeClient(t)
+	fc.createErrs = []error{unavailable, unavailable}
+	fc.startErrs = []error{unavailable, unavailable}
+	r := newTestRunner(fc, WithRetry(3, 10*time.Millisecond))
+
+	start := time.Now()
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want 0", result.ExitCode)
+	}
+	if creates, starts := fc.called("ContainerCreate"), fc.called("ContainerStart"); creates != 3 || starts != 3 {
+		t.Errorf("ContainerCreate called %d times and ContainerStart %d times, want 3 each", creates, starts)
+	}
+	// Two retries of each, 10ms and then 20ms apart.
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("Run took %s, want the retries to back off", d)
+	}
+}
+
+func TestRunRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{name: "permanent", err: errdefs.InvalidParameter(errors.New("bad config")), calls: 1},
+		{name: "transient", err: errdefs.Unavailable(errors.New("daemon restarting")), calls: 3},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		fc.createErrs = []error{tt.err, tt.err, tt.err, tt.err}
+		r := newTestRunner(fc)
+
+		if _, err := r.Run(context.Background(), fakeRequest()); !errors.Is(err, ErrContainerCreate) {
+			t.Errorf("%s: Run error = %v, want ErrContainerCreate", tt.name, err)
+		}
+		if n := fc.called("ContainerCreate"); n != tt.calls {
+			t.Errorf("%s: ContainerCreate called %d times, want %d", tt.name, n, tt.calls)
+		}
+	}
+}
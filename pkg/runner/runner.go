@@ -0,0 +1,1360 @@
+// Package runner executes untrusted code inside isolated Docker containers.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	defaultImage        = "runner"
+	defaultBuildContext = "runner/"
+	defaultDockerfile   = "Dockerfile"
+	defaultTimerScript  = "runner/timer.sh"
+	defaultMemoryBytes  = 10_000_000
+	defaultCPUs         = 1.0
+	defaultPidsLimit    = 64
+	defaultUser         = "1000:1000"
+	defaultMaxOutput    = 1 << 20
+	defaultMaxSource    = 10 << 20
+	defaultMaxFile      = 1 << 20
+	defaultMaxFiles     = 1000
+	defaultMaxOutFiles  = 1 << 20
+	defaultTmpfsBytes   = 64 << 20
+	defaultReadyTimeout = 10 * time.Second
+
+	// codeDir is where the submission is copied to inside the container
+	// unless RunRequest.WorkDir says otherwise. It is also the working
+	// directory of the executed command.
+	codeDir = "/code"
+
+	// cpuPeriod is the CFS scheduler period, in microseconds, that CPU quotas
+	// are expressed against.
+	cpuPeriod = 100_000
+
+	// minMemoryBytes is the smallest memory limit Docker accepts.
+	minMemoryBytes = 6 * 1024 * 1024
+
+	// finishTimeout bounds collecting the result and removing the container
+	// once the program has finished, which no longer depends on the caller's
+	// context.
+	finishTimeout = 10 * time.Second
+)
+
+// timerCmd runs the timer.sh wrapper that is packed next to the submission.
+// The language's command is passed to it as arguments.
+var timerCmd = []string{
+	"sh", "./timer.sh",
+}
+
+// RunRequest describes a single program execution.
+type RunRequest struct {
+	// SourceDir is the directory whose files are copied into /code, along
+	// with the timer.sh wrapper. Neither it, SourceFiles nor ExtraFiles may
+	// contain a timer.sh of their own while the wrapper is packed.
+	SourceDir string
+
+	// MaxSourceBytes and MaxFileBytes cap the total size of the submitted
+	// files, whether read from SourceDir, an archive or given as SourceFiles,
+	// and the size of any single one of them. They default to 10MB and 1MB
+	// when zero.
+	MaxSourceBytes int64
+	MaxFileBytes   int64
+
+	// Exclude lists the patterns, in the syntax of path.Match, of files and
+	// directories of SourceDir that are not packed. A pattern matches either
+	// the path relative to SourceDir or the base name, and skipping a
+	// directory skips everything below it. Defaults to .git and __pycache__
+	// when nil; an empty, non-nil slice packs everything.
+	Exclude []string
+
+	// MaxFiles caps the number of files and directories of the submission,
+	// whether read from SourceDir or given as SourceFiles. Defaults to 1000
+	// when zero.
+	MaxFiles int
+
+	// WorkDir is the absolute path the submission is copied to, which is
+	// also the program's working directory. It defaults to the language's
+	// WorkDir, or /code if that is empty too. Paths documented relative to
+	// /code below are relative to WorkDir.
+	WorkDir string
+
+	// SourceFiles maps paths relative to /code to file contents, which are
+	// packed byte for byte and may be binary. It is used instead of SourceDir
+	// to run a submission that only exists in memory.
+	SourceFiles map[string][]byte
+
+	// ExtraFiles maps paths relative to /code to the contents of files that
+	// are packed next to the submission but are not part of it, e.g. an
+	// input.txt for the program to read. They count towards none of the
+	// source limits, play no part in detecting the language and may not
+	// collide with a submitted file.
+	ExtraFiles map[string][]byte
+
+	// Language selects how the program is run, see RegisterLanguage. When
+	// empty, it is detected from the names of SourceFiles, or of the files
+	// in SourceDir, as DetectLanguage does, falling back to "python" when no file matches a
+	// language. A submission that matches several languages fails with
+	// ErrAmbiguousLanguage.
+	Language string
+
+	// Image overrides the image of the selected language.
+	Image string
+
+	// MemoryBytes is the container memory limit, which also caps swap usage.
+	// Defaults to 10MB when zero and must be at least 6MB otherwise, unless
+	// it is UnlimitedMemory.
+	MemoryBytes int64
+
+	// CPUs is the number of CPUs the program may use, e.g. 0.5 for half a CPU.
+	// It maps to a CFS period of 100000µs and a quota of CPUs*100000µs.
+	// Defaults to 1.0 when zero.
+	CPUs float64
+
+	// CpusetCpus pins the program to the listed CPUs of the host, e.g. "0-1"
+	// or "0,2", to make timings more reproducible. Any CPU may be used when
+	// empty.
+	CpusetCpus string
+
+	// PidsLimit caps the number of processes in the container, guarding the
+	// host against fork bombs. Defaults to 64 when zero.
+	PidsLimit int64
+
+	// GPUs gives the program access to NVIDIA GPUs of the host, either a
+	// number of them such as "1" or "all". No GPU is available by default.
+	// The host needs the NVIDIA driver and the nvidia-container-toolkit
+	// registered with the daemon, and the image needs the CUDA libraries the
+	// program uses.
+	GPUs string
+
+	// Ulimits sets resource limits of the program such as the number of
+	// open files ("nofile") or the size of files it may write ("fsize", in
+	// bytes). Unless set here, nofile defaults to 256 and fsize to 16MB.
+	// "nproc" counts the processes of the user across the whole host rather
+	// than the container, so PidsLimit is usually the better choice.
+	Ulimits []Ulimit
+
+	// Network connects the program to a network. It is either empty or
+	// "none" for no networking at all, the default, "bridge" for Docker's
+	// default bridge network, or the name of a user-defined network, e.g. one
+	// shared with a mock server. Sharing the host's or another container's
+	// network stack is not allowed.
+	Network string
+
+	// BlkioWeight is the program's share of block IO relative to other
+	// containers, from 10 to 1000. It only matters while the disk is
+	// contended, so it does not stop a lone program from writing heavily.
+	BlkioWeight uint16
+
+	// DiskReadBps and DiskWriteBps cap the bytes per second the program may
+	// read from and write to the host block devices they are keyed by, e.g.
+	// "/dev/sda". Unlike BlkioWeight they apply regardless of contention, but
+	// only to the listed devices, so the device backing the daemon's storage
+	// must be named. Writes to the tmpfs at /tmp are not throttled.
+	//
+	// All block IO limits are unset by default. They need the cgroup blkio or
+	// io controller on the host and a storage driver the daemon supports
+	// them for, and are silently ineffective with buffered writes on cgroup
+	// v1.
+	DiskReadBps  map[string]uint64
+	DiskWriteBps map[string]uint64
+
+	// Cmd overrides the command the container runs. It is executed with /code
+	// as the working directory, so relative paths such as "./main.py" resolve
+	// against the submitted files. Defaults to running the timer.sh wrapper
+	// with the language's command when empty, or the language's command alone
+	// when the wrapper is disabled.
+	Cmd []string
+
+	// EntryFile is the path, relative to /code, of the submitted file the
+	// program starts from. It defaults to the language's MainFile and must be
+	// among the submitted files when set.
+	EntryFile string
+
+	// Args are passed to the program after its command, e.g. to be read
+	// through sys.argv. They are handed over as separate arguments and never
+	// interpreted by a shell.
+	Args []string
+
+	// Timeout bounds how long the program may run. The container is killed
+	// once it expires. Zero means no timeout.
+	Timeout time.Duration
+
+	// StopGracePeriod is how long a program that ran into its Timeout gets
+	// to exit after SIGTERM before the daemon kills it, e.g. to flush its
+	// output, which is still collected. It is rounded up to whole seconds.
+	// Zero kills it right away. The timer.sh wrapper passes the signal on,
+	// though no timings are reported then, and not with Tty; with a custom
+	// Cmd it only reaches the container's main process.
+	StopGracePeriod time.Duration
+
+	// ReadyTimeout bounds waiting for the container to run before the
+	// submission is extracted into its tmpfs, see TmpfsBytes. The run fails
+	// with ErrNotReady once it expires. Defaults to 10 seconds when zero.
+	ReadyTimeout time.Duration
+
+	// Deadline bounds the whole run, including resolving or building the
+	// image, creating the container and copying the submission, rather than
+	// just the program. Run then fails with ErrTimeout naming the phase that
+	// was in progress. Collecting the result once the program has exited is
+	// not bounded by it. Zero means no deadline.
+	Deadline time.Duration
+
+	// Stdin, when set, is streamed to the program's standard input, which
+	// is closed once Stdin is exhausted. Programs that never read their
+	// input are not blocked by it.
+	Stdin io.Reader
+
+	// Env sets environment variables for the program. Names must be made of
+	// letters, digits and underscores and not start with a digit. HOME is
+	// set to /tmp by the runner and cannot be overridden.
+	Env map[string]string
+
+	// User is the user, as "uid:gid" or a name known to the image, that the
+	// program runs as. Defaults to the unprivileged "1000:1000". The image
+	// must let that user write to /code, which the runner image does by
+	// creating a "runner" user with that UID and handing /code to it.
+	User string
+
+	// WritableRootfs lets the program write anywhere in the container. By
+	// default the root filesystem is read-only and only /code and /tmp are
+	// writable.
+	WritableRootfs bool
+
+	// TmpfsBytes limits the size of each of the tmpfs mounted at /tmp and
+	// /code when the root filesystem is read-only. Defaults to 64 MiB. As a
+	// tmpfs cannot be copied into from the outside, the container is started
+	// first and the submission is then extracted by tar inside it, so the
+	// image needs sh, tar and sleep. With OutputFiles, /code is a volume
+	// instead, see codeMount, and is not bounded, since a tmpfs is gone once
+	// the program exits.
+	TmpfsBytes int64
+
+	// ShmSize is the size of /dev/shm in bytes, which multiprocessing and
+	// some ML libraries need more of. Zero keeps the daemon's default of
+	// 64 MiB. Shared memory counts towards MemoryBytes like any other.
+	ShmSize int64
+
+	// CapAdd lists Linux capabilities granted back to the program. All
+	// capabilities are dropped by default, and setuid binaries cannot regain
+	// privileges either way.
+	CapAdd []string
+
+	// SeccompProfile restricts the syscalls the program may make. It holds
+	// either a JSON seccomp profile, such as StrictSeccompProfile, or the
+	// path of a file containing one. Docker's default profile applies when
+	// empty.
+	SeccompProfile string
+
+	// InputMounts bind-mounts files or directories of the host into the
+	// container, read-only unless marked writable. Large fixed inputs are
+	// better mounted than copied along with every submission.
+	InputMounts []Mount
+
+	// AutoRemove lets the daemon remove the container as soon as the program
+	// exits, so that no container is left behind even if the runner goes
+	// away mid-run. OOMKilled is never reported then, as the container is
+	// gone before it can be inspected. It cannot be combined with
+	// KeepOnFailure.
+	AutoRemove bool
+
+	// RequestID identifies the run in log lines, in RunResult.RequestID and
+	// in the "mtstnt-runner.request-id" label of its container, next to the
+	// "created-by=mtstnt-runner" label every container carries. A random ID
+	// is generated when empty. Containers taken from a pool, see WithPool,
+	// are created ahead of their run and do not carry the label.
+	RequestID string
+
+	// KeepOnFailure keeps the container instead of removing it when the run
+	// fails or the program exits with a non-zero status, so that it can be
+	// inspected with docker exec. Its ID is logged.
+	KeepOnFailure bool
+
+	// Tty allocates a pseudo-terminal for the program. Its output is then not
+	// multiplexed, so everything it prints is reported as Stdout, and the
+	// terminal's CRLF line endings are converted to LF as with
+	// NormalizeOutput. The terminal also echoes Stdin into the output.
+	Tty bool
+
+	// MaxOutputBytes caps the combined size of stdout and stderr. The
+	// program is stopped once it prints more than that. The lines the timing
+	// and compile wrappers add do not count. Defaults to 1MB when zero.
+	MaxOutputBytes int64
+
+	// OutputFiles lists files or directories, relative to /code, that the
+	// program writes and that are copied into RunResult.OutputFiles once it
+	// has exited. It cannot be combined with AutoRemove.
+	OutputFiles []string
+
+	// MaxOutputFileBytes caps the total size of the files copied for
+	// OutputFiles. Defaults to 1MB when zero.
+	MaxOutputFileBytes int64
+
+	// Stdout and Stderr, when set, receive the program's output live while
+	// it runs. The output is still collected into the RunResult as well,
+	// unless StreamOnly is set. The timing line of the timer.sh wrapper is
+	// only stripped from the latter.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// StreamOnly leaves RunResult.Stdout or Stderr empty when the output
+	// goes to the Stdout or Stderr writer, sparing the buffer. Timings are
+	// still taken from the end of the output, but compile output is not
+	// split off.
+	StreamOnly bool
+
+	// NormalizeOutput converts CRLF line endings of the captured stdout to LF,
+	// so that output compares equal across images. TrimTrailingSpace also
+	// strips trailing spaces and tabs from every line. The unmodified output
+	// is kept in RunResult.RawStdout either way.
+	NormalizeOutput   bool
+	TrimTrailingSpace bool
+
+	// CombinedLog records the program's output as it arrives, both streams
+	// interleaved, into RunResult.CombinedLog. Stdout and Stderr are still
+	// collected as well.
+	CombinedLog bool
+
+	// LogDetails includes extra attributes provided to the log driver in the
+	// captured output. It has no effect with AutoRemove.
+	LogDetails bool
+}
+
+// UnlimitedMemory as RunRequest.MemoryBytes runs the program without a memory
+// limit. It is meant for trusted code only: an untrusted program can then
+// exhaust the memory of the host, and only the kernel's OOM killer stops it,
+// taking whatever process it picks.
+const UnlimitedMemory = -1
+
+// RunResult holds the outcome of a program execution.
+type RunResult struct {
+	// RequestID is RunRequest.RequestID, or the ID generated in its place.
+	RequestID string
+
+	// Language is the name of the language the program was run as.
+	Language string
+
+	Stdout string
+	Stderr string
+
+	// RawStdout is the stdout as printed by the program, before
+	// RunRequest.NormalizeOutput was applied. It equals Stdout otherwise.
+	RawStdout string
+
+	// ExitCode is the status code the program exited with.
+	ExitCode int
+
+	// TimedOut reports whether the program was killed because it exceeded
+	// RunRequest.Timeout. Output produced until then is still returned.
+	TimedOut bool
+
+	// OutputTruncated reports whether the program was stopped because its
+	// output exceeded RunRequest.MaxOutputBytes. Stdout and Stderr then hold
+	// the output up to the cap.
+	OutputTruncated bool
+
+	// PeakMemoryBytes is the highest memory usage sampled while the program
+	// ran. It is zero when the daemon did not provide stats.
+	PeakMemoryBytes int64
+
+	// WallTime and CPUTime are the elapsed and user plus system time of the
+	// program as measured by the timer.sh wrapper. They are zero when the
+	// wrapper is not used or the image lacks GNU time.
+	WallTime time.Duration
+	CPUTime  time.Duration
+
+	// Elapsed is how long the program ran as measured by the runner, from
+	// its start until it exited or was stopped. Unlike WallTime, it is set
+	// with any image, but includes the overhead of the container.
+	Elapsed time.Duration
+
+	// OOMKilled reports whether the program was killed for exceeding
+	// RunRequest.MemoryBytes, as opposed to exiting because of an error of
+	// its own.
+	OOMKilled bool
+
+	// CompileStderr is the output of the language's CompileCmd, which is
+	// not part of Stdout or Stderr. CompileFailed reports whether it failed,
+	// in which case the program was not run and ExitCode is the status of
+	// the compiler.
+	CompileStderr string
+	CompileFailed bool
+
+	// Diagnostics are the errors parsed from CompileStderr, if compiling
+	// failed, or from Stderr otherwise, for languages that support it, see
+	// Language.Diagnose. Stderr keeps the raw output either way.
+	Diagnostics []Diagnostic
+
+	// OutputFiles holds the contents of the regular files found at
+	// RunRequest.OutputFiles, keyed by their path relative to /code. Files
+	// the program did not create are missing. OutputFilesTruncated reports
+	// whether files were left out for exceeding
+	// RunRequest.MaxOutputFileBytes.
+	OutputFiles          map[string][]byte
+	OutputFilesTruncated bool
+
+	// CombinedLog holds the chunks of output in the order they were received
+	// when RunRequest.CombinedLog is set. The daemon keeps the order of
+	// writes, but the chunks are as the daemon sent them and not split into
+	// lines, except that the start of a line that may be a wrapper's is held
+	// back until the chunk that tells. They include the timing line of the
+	// timer.sh wrapper, and chunks past MaxOutputBytes are cut off there as
+	// well.
+	CombinedLog []LogChunk
+}
+
+// Runner runs programs in Docker containers through a Docker client.
+type Runner struct {
+	dc DockerClient
+
+	buildContext string
+	dockerfile   string
+	pullImage    string
+	buildOutput  io.Writer
+	timerScript  string
+	tempDir      string
+
+	compressContext bool
+
+	pool    *containerPool
+	metrics Metrics
+	tracer  Tracer
+	sink    ResultSink
+	retry   retryPolicy
+
+	strict bool
+
+	mu       sync.Mutex
+	live     map[string]struct{}
+	isolated bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithBuildOutput streams the log of image builds to w.
+func WithBuildOutput(w io.Writer) Option {
+	return func(r *Runner) {
+		r.buildOutput = w
+	}
+}
+
+// WithBuildContext builds the runner image from dir instead of the runner/
+// directory, using the Dockerfile named dockerfile within it. dockerfile
+// defaults to "Dockerfile" when empty. The image must still provide
+// everything the runner relies on, such as sh and a user the program can run
+// as; the timer.sh wrapper is still read from runner/ unless changed through
+// WithTimerScript.
+func WithBuildContext(dir, dockerfile string) Option {
+	return func(r *Runner) {
+		r.buildContext = dir
+		if dockerfile != "" {
+			r.dockerfile = dockerfile
+		}
+	}
+}
+
+// WithCompressedBuildContext gzips the build context sent to the daemon when
+// building the runner image, which the daemon decompresses itself. This
+// trades CPU time for bandwidth, which pays off with remote daemons on slow
+// links.
+func WithCompressedBuildContext() Option {
+	return func(r *Runner) {
+		r.compressContext = true
+	}
+}
+
+// WithPullImage uses ref, e.g. "registry.example.com/runner:1.2", as the
+// runner image instead of building it from the build context. The image is
+// pulled, with its progress streamed to the build output, whenever it is not
+// present on the daemon. Registries requiring authentication are not
+// supported.
+func WithPullImage(ref string) Option {
+	return func(r *Runner) {
+		r.pullImage = ref
+	}
+}
+
+// WithTimerScript packs the file at path as timer.sh next to every submission
+// instead of runner/timer.sh. A custom wrapper must run its arguments and may
+// report timings the same way runner/timer.sh does. An empty path disables the
+// wrapper: nothing is packed, languages' commands run directly and runs report
+// no timings.
+func WithTimerScript(path string) Option {
+	return func(r *Runner) {
+		r.timerScript = path
+	}
+}
+
+// WithTempDir makes the Runner write intermediate files, such as uploaded
+// archives being unpacked, below dir instead of the default directory for
+// temporary files. Every run gets its own subdirectory, which is removed once
+// the run is over.
+func WithTempDir(dir string) Option {
+	return func(r *Runner) {
+		r.tempDir = dir
+	}
+}
+
+// New returns a Runner that uses dc to talk to the Docker daemon. The image
+// build context and timer.sh wrapper are read from the runner/ directory
+// relative to the working directory.
+func New(dc DockerClient, opts ...Option) *Runner {
+	r := &Runner{
+		dc:           dc,
+		buildContext: defaultBuildContext,
+		dockerfile:   defaultDockerfile,
+		metrics:      noMetrics{},
+		tracer:       noTracer{},
+		sink:         noSink{},
+		timerScript:  defaultTimerScript,
+		live:         make(map[string]struct{}),
+		retry: retryPolicy{
+			attempts:  defaultRetryAttempts,
+			baseDelay: defaultRetryDelay,
+		},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// RunArchive runs the submission contained in archive, a tar, gzip-compressed
+// tar or zip file, as if its files were passed through req.SourceFiles. Entries
+// with absolute paths or paths escaping the archive root are rejected.
+func (r *Runner) RunArchive(ctx context.Context, req RunRequest, archive io.Reader) (RunResult, error) {
+	scratchDir, err := os.MkdirTemp(r.tempDir, "runner-")
+	if err != nil {
+		return RunResult{}, fmt.Errorf("create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratchDir)
+
+	limits, err := newSourceLimits(req)
+	if err != nil {
+		return RunResult{}, err
+	}
+	sourceFiles, err := readArchiveFiles(archive, scratchDir, &limits)
+	if err != nil {
+		return RunResult{}, err
+	}
+	if len(sourceFiles) == 0 {
+		return RunResult{}, fmt.Errorf("archive: %w", ErrSourceEmpty)
+	}
+
+	req.SourceDir = ""
+	req.SourceFiles = sourceFiles
+	return r.Run(ctx, req)
+}
+
+// submittedNames returns the names of the files of req's submission, whether
+// given as SourceFiles or found in SourceDir, to detect its language from.
+func submittedNames(req RunRequest) []string {
+	if len(req.SourceFiles) > 0 {
+		names := make([]string, 0, len(req.SourceFiles))
+		for name := range req.SourceFiles {
+			names = append(names, name)
+		}
+		return names
+	}
+	if req.SourceDir == "" {
+		return nil
+	}
+
+	exclude := req.Exclude
+	if exclude == nil {
+		exclude = defaultExclude
+	}
+	maxFiles := req.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFiles
+	}
+	return sourceDirNames(req.SourceDir, exclude, maxFiles)
+}
+
+// Run executes req in a fresh container and returns its captured output. The
+// container is removed once the program has finished. Cancelling ctx while
+// the program runs aborts the run, but once the program has exited its result
+// is reported even if ctx is cancelled afterwards.
+//
+// Failures are wrapped with the Err* errors of this package where they apply.
+// A program exiting with a non-zero status, timing out or running out of
+// memory is not a failure; see RunResult.Err.
+func (r *Runner) Run(ctx context.Context, req RunRequest) (RunResult, error) {
+	if req.RequestID == "" {
+		req.RequestID = newRequestID()
+	}
+	langName := req.Language
+	if langName == "" {
+		if names := submittedNames(req); len(names) > 0 {
+			detected, err := detectLanguage(names)
+			switch {
+			case err == nil:
+				langName = detected
+			case !errors.Is(err, ErrUnknownLanguage):
+				return RunResult{RequestID: req.RequestID}, err
+			}
+		}
+	}
+	if langName == "" {
+		langName = defaultLanguage
+	}
+	req.Language = langName
+	if req.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Deadline)
+		defer cancel()
+	}
+
+	start := time.Now()
+	r.metrics.RunStarted(langName)
+	spanCtx, span := r.tracer.Start(ctx, "runner.run")
+	span.SetAttribute("runner.language", langName)
+	span.SetAttribute("runner.request_id", req.RequestID)
+
+	result, err := r.run(spanCtx, req)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, ErrTimeout) {
+		err = fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	if err == nil {
+		span.SetAttribute("runner.exit_code", result.ExitCode)
+		span.SetAttribute("runner.timed_out", result.TimedOut)
+		span.SetAttribute("runner.oom_killed", result.OOMKilled)
+	}
+	result.RequestID = req.RequestID
+	result.Language = langName
+	span.End(err)
+	r.metrics.RunFinished(langName, result, err, time.Since(start))
+	if err == nil {
+		// ctx is often done by now for runs that timed out or were cancelled
+		// right after the program exited, which are still recorded.
+		recordCtx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+		if err := r.sink.Record(recordCtx, result); err != nil {
+			log.Printf("runner: request_id=%s recording result: %v", req.RequestID, err)
+		}
+		cancel()
+	}
+	return result, err
+}
+
+func (r *Runner) run(ctx context.Context, req RunRequest) (_ RunResult, err error) {
+	// Failures end the phase they happen in, and a deadline running out
+	// names it.
+	phases := &phases{ctx: ctx, tracer: r.tracer}
+	validated := false
+	defer func() {
+		if err != nil && !validated {
+			err = fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%s: %w", phases.name(), err)
+		}
+		phases.end(err)
+	}()
+
+	langName := req.Language
+	if langName == "" {
+		langName = defaultLanguage
+	}
+	lang, err := LookupLanguage(langName)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	var (
+		image       = req.Image
+		memoryLimit = req.MemoryBytes
+		cpus        = req.CPUs
+		pidsLimit   = req.PidsLimit
+		maxOutput   = req.MaxOutputBytes
+		cmd         = req.Cmd
+		user        = req.User
+		workDir     = req.WorkDir
+	)
+	if image == "" {
+		image = lang.Image
+	}
+	if memoryLimit == 0 {
+		memoryLimit = defaultMemoryBytes
+	}
+	if memoryLimit == UnlimitedMemory {
+		// Docker reads a zero limit as none.
+		memoryLimit = 0
+	} else if memoryLimit < minMemoryBytes {
+		return RunResult{}, fmt.Errorf("memory limit of %d bytes is below the minimum of %d bytes", memoryLimit, minMemoryBytes)
+	}
+	if cpus == 0 {
+		cpus = defaultCPUs
+	}
+	if cpus < 0 {
+		return RunResult{}, fmt.Errorf("cpu limit of %g is negative", cpus)
+	}
+	if pidsLimit == 0 {
+		pidsLimit = defaultPidsLimit
+	}
+	if pidsLimit < 0 {
+		return RunResult{}, fmt.Errorf("pids limit of %d is negative", pidsLimit)
+	}
+	if maxOutput == 0 {
+		maxOutput = defaultMaxOutput
+	}
+	if maxOutput < 0 {
+		return RunResult{}, fmt.Errorf("output limit of %d bytes is negative", maxOutput)
+	}
+	readyTimeout := req.ReadyTimeout
+	if readyTimeout == 0 {
+		readyTimeout = defaultReadyTimeout
+	}
+	if readyTimeout < 0 {
+		return RunResult{}, fmt.Errorf("ready timeout of %s is negative", readyTimeout)
+	}
+	if req.StopGracePeriod < 0 {
+		return RunResult{}, fmt.Errorf("stop grace period of %s is negative", req.StopGracePeriod)
+	}
+	if req.AutoRemove && req.KeepOnFailure {
+		return RunResult{}, errors.New("only one of AutoRemove and KeepOnFailure may be set")
+	}
+	if req.AutoRemove && len(req.OutputFiles) > 0 {
+		return RunResult{}, errors.New("output files cannot be collected with AutoRemove")
+	}
+	for _, name := range req.OutputFiles {
+		cleaned, err := validateSourcePath(name)
+		if err != nil {
+			return RunResult{}, fmt.Errorf("output file: %w", err)
+		}
+		if cleaned == "." {
+			return RunResult{}, errors.New("output file may not be the working directory itself")
+		}
+	}
+	maxOutFiles := req.MaxOutputFileBytes
+	if maxOutFiles == 0 {
+		maxOutFiles = defaultMaxOutFiles
+	}
+	tmpfsSize := req.TmpfsBytes
+	if tmpfsSize == 0 {
+		tmpfsSize = defaultTmpfsBytes
+	}
+	if tmpfsSize < 0 {
+		return RunResult{}, fmt.Errorf("tmpfs size of %d bytes is negative", tmpfsSize)
+	}
+	if req.ShmSize < 0 {
+		return RunResult{}, fmt.Errorf("shm size of %d bytes is negative", req.ShmSize)
+	}
+	if err := validateCpuset(req.CpusetCpus); err != nil {
+		return RunResult{}, err
+	}
+	if err := validateBlkioWeight(req.BlkioWeight); err != nil {
+		return RunResult{}, err
+	}
+	exclude := req.Exclude
+	if exclude == nil {
+		exclude = defaultExclude
+	}
+	if err := validateExclude(exclude); err != nil {
+		return RunResult{}, err
+	}
+	limits, err := newSourceLimits(req)
+	if err != nil {
+		return RunResult{}, err
+	}
+	if err := checkMemorySourceFiles(req.SourceFiles, &limits); err != nil {
+		return RunResult{}, err
+	}
+	if user == "" {
+		user = defaultUser
+	}
+	if workDir == "" {
+		workDir = lang.WorkDir
+	}
+	if workDir == "" {
+		workDir = codeDir
+	}
+	if !path.IsAbs(workDir) {
+		return RunResult{}, fmt.Errorf("working directory %s is not absolute", workDir)
+	}
+	workDir = path.Clean(workDir)
+	entry := lang.MainFile
+	if req.EntryFile != "" {
+		if entry, err = validateSourcePath(req.EntryFile); err != nil {
+			return RunResult{}, err
+		}
+	}
+
+	if len(req.SourceFiles) > 0 && req.SourceDir != "" {
+		return RunResult{}, errors.New("only one of SourceDir and SourceFiles may be set")
+	}
+	if len(req.SourceFiles) == 0 && req.SourceDir == "" {
+		return RunResult{}, ErrSourceEmpty
+	}
+	for name := range req.ExtraFiles {
+		cleaned, err := validateSourcePath(name)
+		if err != nil {
+			return RunResult{}, fmt.Errorf("extra file: %w", err)
+		}
+		if cleaned == "." {
+			return RunResult{}, errors.New("extra file may not be the working directory itself")
+		}
+		if err := checkTimerCollision(cleaned, r.timerScript); err != nil {
+			return RunResult{}, fmt.Errorf("extra file: %w", err)
+		}
+	}
+	if len(req.SourceFiles) == 0 {
+		if err := validateSourceDir(req.SourceDir); err != nil {
+			return RunResult{}, err
+		}
+	} else {
+		for name := range req.SourceFiles {
+			cleaned, err := validateSourcePath(name)
+			if err != nil {
+				return RunResult{}, err
+			}
+			if err := checkTimerCollision(cleaned, r.timerScript); err != nil {
+				return RunResult{}, err
+			}
+		}
+	}
+
+	env, err := containerEnv(req.Env)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	mounts, err := inputMounts(req.InputMounts, workDir)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	rlimits, err := ulimits(req.Ulimits)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	gpus, err := deviceRequests(req.GPUs)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	netMode, err := networkMode(req.Network)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	seccomp, err := seccompOpt(req.SeccompProfile)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	// Everything that can be checked without the daemon or the submission's
+	// contents is checked above, so that invalid requests fail fast. From
+	// here on failures are the runner's rather than the request's.
+	validated = true
+	if r.timerScript != "" {
+		if err := validateTimerScript(r.timerScript); err != nil {
+			return RunResult{}, err
+		}
+	}
+	if err := r.checkIsolation(ctx); err != nil {
+		return RunResult{}, err
+	}
+
+	phases.next("runner.ensure_image")
+	imageID, err := r.ensureImage(ctx, image)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	phases.next("runner.load_source")
+	var sourceFiles []sourceFile
+	if len(req.SourceFiles) == 0 {
+		if sourceFiles, err = loadSourceFiles(req.SourceDir, &limits, exclude); err != nil {
+			return RunResult{}, err
+		}
+		for _, file := range sourceFiles {
+			if err := checkTimerCollision(file.Name, r.timerScript); err != nil {
+				return RunResult{}, fmt.Errorf("%w: source directory %s: %w", ErrInvalidRequest, req.SourceDir, err)
+			}
+		}
+	} else {
+		sourceFiles = memorySourceFiles(req.SourceFiles)
+	}
+	if req.EntryFile != "" && !hasFile(sourceFiles, entry) {
+		return RunResult{}, fmt.Errorf("%w: entry file %s is not among the submitted files", ErrInvalidRequest, req.EntryFile)
+	}
+
+	files := sourceNames(sourceFiles, path.Ext(entry))
+	for name := range req.ExtraFiles {
+		if cleaned, _ := validateSourcePath(name); hasFile(sourceFiles, cleaned) {
+			return RunResult{}, fmt.Errorf("%w: extra file %s collides with a submitted file", ErrInvalidRequest, name)
+		}
+	}
+	sourceFiles = append(sourceFiles, memorySourceFiles(req.ExtraFiles)...)
+	compile := len(cmd) == 0 && len(lang.CompileCmd) > 0
+	wrapped := len(cmd) == 0 && (r.timerScript != "" || compile)
+	if len(cmd) == 0 && r.timerScript == "" {
+		cmd = expandArgs(lang.Cmd, entry, files)
+	} else if len(cmd) == 0 {
+		cmd = append(append([]string{}, timerCmd...), expandArgs(lang.Cmd, entry, files)...)
+	}
+	// Cap the slice so that appending never writes into req.Cmd.
+	cmd = append(cmd[:len(cmd):len(cmd)], req.Args...)
+	if compile {
+		cmd = compileCmd(expandArgs(lang.CompileCmd, entry, files), cmd)
+	}
+	// The working directory is a tmpfs unless output files are collected
+	// from it, so the submission is only copied once the container runs.
+	codeInTmpfs := !req.WritableRootfs && len(req.OutputFiles) == 0
+	if codeInTmpfs {
+		cmd = gateCmd(cmd)
+	}
+
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:     memoryLimit,
+			MemorySwap: memoryLimit,
+			CPUPeriod:  cpuPeriod,
+			CPUQuota:   cpuQuota(cpus),
+			CpusetCpus: req.CpusetCpus,
+			PidsLimit:  &pidsLimit,
+			Ulimits:    rlimits,
+			Devices:    nil,
+
+			DeviceRequests: gpus,
+
+			BlkioWeight:         req.BlkioWeight,
+			BlkioDeviceReadBps:  throttleDevices(req.DiskReadBps),
+			BlkioDeviceWriteBps: throttleDevices(req.DiskWriteBps),
+		},
+		NetworkMode:    netMode,
+		Privileged:     false,
+		ReadonlyRootfs: !req.WritableRootfs,
+		AutoRemove:     req.AutoRemove,
+		ShmSize:        req.ShmSize,
+		CapDrop:        []string{"ALL"},
+		CapAdd:         req.CapAdd,
+		SecurityOpt:    []string{"no-new-privileges:true"},
+
+		// Never relaunch a program, whatever the daemon's default.
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+	}
+	if seccomp != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, seccomp)
+	}
+	if !req.WritableRootfs {
+		hostConfig.Tmpfs = map[string]string{
+			"/tmp": fmt.Sprintf("size=%d", tmpfsSize),
+		}
+	}
+	if codeInTmpfs {
+		hostConfig.Tmpfs[workDir] = codeTmpfs(tmpfsSize)
+	} else if !req.WritableRootfs {
+		hostConfig.Mounts = []mount.Mount{codeMount(workDir)}
+	}
+	hostConfig.Mounts = append(hostConfig.Mounts, mounts...)
+
+	// A request ID label would keep pooled containers from ever matching.
+	labels := containerLabels(req.RequestID)
+	if r.pool != nil {
+		labels = containerLabels("")
+	}
+
+	config := &container.Config{
+		Image:           imageID,
+		NetworkDisabled: netMode.IsNone(),
+		WorkingDir:      workDir,
+		Cmd:             cmd,
+		Env:             env,
+		User:            user,
+		Tty:             req.Tty,
+		OpenStdin:       req.Stdin != nil,
+		StdinOnce:       req.Stdin != nil,
+		AttachStdin:     req.Stdin != nil,
+		Labels:          labels,
+	}
+
+	phases.next("runner.create_container")
+	var containerID string
+	err = r.retry.do(ctx, transientCreate, func() error {
+		id, err := r.createContainer(ctx, config, hostConfig)
+		containerID = id
+		return err
+	})
+	if err != nil {
+		return RunResult{}, fmt.Errorf("%w: %w", ErrContainerCreate, err)
+	}
+
+	// cleanup removes the container, killing the program if it still runs,
+	// unless the run failed and the request asks to keep it around for
+	// inspection, in which case it is only stopped. It is detached from ctx,
+	// which may well be what failed the run.
+	cleanup := func(failed bool) error {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+		defer cancel()
+
+		if failed && req.KeepOnFailure {
+			r.untrack(containerID)
+			log.Printf("runner: request_id=%s keeping container %s of failed run for inspection", req.RequestID, containerID)
+			return stopContainer(cleanupCtx, r.dc, containerID, 0)
+		}
+		err := r.dispose(cleanupCtx, containerID)
+		if req.AutoRemove && (errdefs.IsNotFound(err) || errdefs.IsConflict(err)) {
+			// The daemon removed or is removing the container already.
+			r.untrack(containerID)
+			return nil
+		}
+		return err
+	}
+
+	phases.next("runner.build_tar")
+	content, err := createTarfileOfCode(sourceFiles, r.timerScript)
+	if err != nil {
+		return RunResult{}, errors.Join(err, cleanup(true))
+	}
+	defer content.Close()
+
+	if !codeInTmpfs {
+		phases.next("runner.copy")
+		if err := r.dc.CopyToContainer(
+			ctx,
+			containerID,
+			workDir,
+			content,
+			types.CopyToContainerOptions{
+				AllowOverwriteDirWithFile: true,
+			},
+		); err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+	}
+
+	if req.Stdin != nil {
+		hr, err := attachStdin(ctx, r.dc, containerID, req.Stdin)
+		if err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		defer hr.Close()
+	}
+
+	var (
+		bufStdout    collector = bytes.NewBuffer(nil)
+		bufStderr    collector = bytes.NewBuffer(nil)
+		streamStdout           = req.StreamOnly && req.Stdout != nil
+		streamStderr           = req.StreamOnly && req.Stderr != nil
+	)
+	if streamStdout {
+		bufStdout = &tailBuffer{n: tailSize}
+	}
+	if streamStderr {
+		bufStderr = &tailBuffer{n: tailSize}
+	}
+	var (
+		stdout io.Writer = bufStdout
+		stderr io.Writer = bufStderr
+	)
+	if req.Stdout != nil {
+		stdout = io.MultiWriter(bufStdout, req.Stdout)
+	}
+	if req.Stderr != nil {
+		stderr = io.MultiWriter(bufStderr, req.Stderr)
+	}
+
+	var combined *combinedLog
+	if req.CombinedLog {
+		combined = newCombinedLog()
+		stdout = io.MultiWriter(stdout, combined.Writer("stdout"))
+		stderr = io.MultiWriter(stderr, combined.Writer("stderr"))
+	}
+
+	// The lines the timer and compile wrappers add to the program's output
+	// are not charged to it.
+	limit := newOutputLimit(maxOutput)
+	switch {
+	case wrapped && req.Tty:
+		stdout = limit.WrapperWriter(stdout)
+		stderr = limit.Writer(stderr)
+	case wrapped:
+		stdout = limit.Writer(stdout)
+		stderr = limit.WrapperWriter(stderr)
+	default:
+		stdout = limit.Writer(stdout)
+		stderr = limit.Writer(stderr)
+	}
+
+	// Follow the output while the program runs so that it reaches the
+	// writers live and the output cap is enforced as it is hit. The stream
+	// ends by itself once the container stops, so it is not bound to ctx:
+	// output must still be read when ctx is cancelled right after the
+	// program exited. It is only cut short when run returns early.
+	//
+	// An auto-removed container may be gone as soon as the program exits,
+	// so its output is attached to before it starts. The logs of any other
+	// container are followed once it has started.
+	logsCtx, cancelLogs := context.WithCancel(context.Background())
+	defer cancelLogs()
+	var output io.ReadCloser
+	if req.AutoRemove {
+		output, err = attachOutput(logsCtx, r.dc, containerID)
+		if err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		defer output.Close()
+	}
+
+	// The exit is waited for from before the start for the same reason.
+	waitCtx, cancelWait := context.WithCancel(ctx)
+	defer cancelWait()
+	condition := container.WaitConditionNextExit
+	if req.AutoRemove {
+		condition = container.WaitConditionRemoved
+	}
+	wr, errCh := r.dc.ContainerWait(waitCtx, containerID, condition)
+
+	phases.next("runner.start")
+	if err := r.retry.do(ctx, transient, func() error {
+		return r.dc.ContainerStart(
+			ctx,
+			containerID,
+			types.ContainerStartOptions{},
+		)
+	}); err != nil {
+		err = fmt.Errorf("%w: %w", ErrContainerStart, err)
+		// The daemon's answer does not always carry the reason itself.
+		if stateErr := startError(ctx, r.dc, containerID); stateErr != "" && !strings.Contains(err.Error(), stateErr) {
+			err = fmt.Errorf("%w (container state: %s)", err, stateErr)
+		}
+		return RunResult{}, errors.Join(err, cleanup(true))
+	}
+
+	if codeInTmpfs {
+		phases.next("runner.ready")
+		if err := waitRunning(ctx, r.dc, containerID, readyTimeout); err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		phases.next("runner.copy")
+		if err := extractCode(ctx, r.dc, containerID, user, workDir, content); err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+	}
+
+	started := time.Now()
+	if req.Timeout > 0 {
+		timer := time.AfterFunc(req.Timeout, cancelWait)
+		defer timer.Stop()
+	}
+
+	statsCtx, cancelStats := context.WithCancel(ctx)
+	defer cancelStats()
+	peakCh := samplePeakMemory(statsCtx, r.dc, containerID)
+
+	if !req.AutoRemove {
+		f, err := followLogs(logsCtx, r.dc, containerID, req.LogDetails)
+		if err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		defer f.Close()
+		output = f
+	}
+
+	logsDone := make(chan error, 1)
+	go func() {
+		logsDone <- readLogs(output, req.Tty, stdout, stderr)
+	}()
+
+	phases.next("runner.wait")
+
+	// A non-zero status code is a legitimate program result and is reported
+	// through RunResult.ExitCode rather than as an error.
+	var (
+		exitCode  int
+		timedOut  bool
+		truncated bool
+	)
+	select {
+	case c := <-wr:
+		if c.Error != nil {
+			err := fmt.Errorf("wait for container: %s", c.Error.Message)
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		exitCode = int(c.StatusCode)
+	case err := <-errCh:
+		if ctx.Err() != nil {
+			// ctx may have been cancelled after the program exited but
+			// before the wait returned, in which case the result is
+			// complete and still reported.
+			code, exited := exitStatus(r.dc, containerID)
+			if !exited {
+				return RunResult{}, errors.Join(err, cleanup(true))
+			}
+			exitCode = code
+			break
+		}
+		// Short of ctx, only the timeout cancels waitCtx.
+		if waitCtx.Err() == nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+
+		// The timeout expired, so kill the program but keep whatever it
+		// printed so far.
+		timedOut = true
+		if err := stopContainer(ctx, r.dc, containerID, req.StopGracePeriod); err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+	case <-limit.Exceeded():
+		truncated = true
+		if err := stopContainer(ctx, r.dc, containerID, 0); err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+	}
+
+	elapsed := time.Since(started)
+
+	// The program has stopped, so collect its result even if ctx is cancelled
+	// from here on.
+	finishCtx, cancelFinish := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancelFinish()
+
+	phases.next("runner.collect_logs")
+	if err := <-logsDone; err != nil {
+		return RunResult{}, errors.Join(err, cleanup(true))
+	}
+	if err := limit.Flush(); err != nil {
+		return RunResult{}, errors.Join(err, cleanup(true))
+	}
+
+	cancelStats()
+	peakMemory := <-peakCh
+
+	// The program may have exited on its own right after going over the cap.
+	select {
+	case <-limit.Exceeded():
+		truncated = true
+	default:
+	}
+
+	var (
+		outStdout = bufStdout.String()
+		outStderr = bufStderr.String()
+		wallTime  time.Duration
+		cpuTime   time.Duration
+	)
+	var (
+		compileOutput string
+		compileFailed bool
+	)
+	if req.Tty {
+		if compile {
+			outStdout, compileOutput, compileFailed = extractCompile(outStdout)
+		}
+		outStdout, wallTime, cpuTime = extractTiming(outStdout)
+	} else {
+		if compile {
+			outStderr, compileOutput, compileFailed = extractCompile(outStderr)
+		}
+		outStderr, wallTime, cpuTime = extractTiming(outStderr)
+	}
+	var diagnostics []Diagnostic
+	if lang.Diagnose != nil {
+		errOutput := outStderr
+		if req.Tty {
+			errOutput = outStdout
+		}
+		if compileFailed {
+			errOutput = compileOutput
+		}
+		diagnostics = lang.Diagnose(errOutput, workDir)
+	}
+	if streamStdout {
+		outStdout = ""
+	}
+	if streamStderr {
+		outStderr = ""
+	}
+
+	phases.next("runner.finish")
+
+	// The OOM killer leaves nothing but a non-zero exit behind, so ask the
+	// daemon.
+	var oomKilled bool
+	if !req.AutoRemove {
+		info, err := r.dc.ContainerInspect(finishCtx, containerID)
+		if err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+		oomKilled = info.State != nil && info.State.OOMKilled
+	}
+
+	var (
+		outFiles      map[string][]byte
+		outFilesTrunc bool
+	)
+	if len(req.OutputFiles) > 0 {
+		outFiles, outFilesTrunc, err = outputFiles(finishCtx, r.dc, containerID, workDir, req.OutputFiles, maxOutFiles)
+		if err != nil {
+			return RunResult{}, errors.Join(err, cleanup(true))
+		}
+	}
+
+	// The terminal turns every LF the program prints into CRLF.
+	rawStdout := outStdout
+	if req.NormalizeOutput || req.Tty {
+		outStdout = normalizeOutput(outStdout, req.NormalizeOutput && req.TrimTrailingSpace)
+	}
+
+	var combinedChunks []LogChunk
+	if combined != nil {
+		combinedChunks = combined.Chunks()
+	}
+
+	if err := cleanup(exitCode != 0); err != nil {
+		return RunResult{}, err
+	}
+	return RunResult{
+		Stdout:   outStdout,
+		Stderr:   outStderr,
+		ExitCode: exitCode,
+		TimedOut: timedOut,
+
+		RawStdout:       rawStdout,
+		CompileStderr:   compileOutput,
+		CompileFailed:   compileFailed,
+		Diagnostics:     diagnostics,
+		OutputTruncated: truncated,
+		PeakMemoryBytes: peakMemory,
+		WallTime:        wallTime,
+		CPUTime:         cpuTime,
+		Elapsed:         elapsed,
+		OOMKilled:       oomKilled,
+
+		OutputFiles:          outFiles,
+		OutputFilesTruncated: outFilesTrunc,
+		CombinedLog:          combinedChunks,
+	}, nil
+}
+
+// collector collects output of the program.
+type collector interface {
+	io.Writer
+	String() string
+}
+
+// cpuQuota converts a number of CPUs into a CFS quota against cpuPeriod.
+func cpuQuota(cpus float64) int64 {
+	return int64(cpus * cpuPeriod)
+}
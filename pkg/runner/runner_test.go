@@ -0,0 +1,697 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// newDockerRunner returns a Runner talking to the Docker daemon of the
+// environment and building the runner image from the repository, skipping the
+// test when there is no daemon or in short mode.
+func newDockerRunner(t *testing.T, opts ...Option) *Runner {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("needs a Docker daemon")
+	}
+	opts = append([]Option{
+		WithBuildContext("../../runner", ""),
+		WithTimerScript(testTimerScript),
+	}, opts...)
+	r, err := NewFromEnv(opts...)
+	if err != nil {
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := r.Ping(ctx); err != nil {
+		r.Close()
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRunReturnsExitCode(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{errChunk("failing\n")}, code: 3}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", result.ExitCode)
+	}
+	if result.Stderr != "failing\n" {
+		t.Errorf("Stderr = %q, want %q", result.Stderr, "failing\n")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk("started\n")}, hang: true}
+	}
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Timeout = 100 * time.Millisecond
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.TimedOut {
+		t.Error("TimedOut = false, want true")
+	}
+	if result.Stdout != "started\n" {
+		t.Errorf("Stdout = %q, want the output printed before the timeout", result.Stdout)
+	}
+	if n := fc.called("ContainerRemove"); n != 1 {
+		t.Errorf("ContainerRemove called %d times, want 1", n)
+	}
+}
+
+func TestRunTimeoutDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("print('started', flush=True)\nwhile True: pass\n"),
+		},
+		Timeout: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.TimedOut {
+		t.Error("TimedOut = false, want true")
+	}
+	if result.Stdout != "started\n" {
+		t.Errorf("Stdout = %q, want the output printed before the timeout", result.Stdout)
+	}
+}
+
+func TestRunStopGracePeriod(t *testing.T) {
+	for _, tt := range []struct {
+		grace time.Duration
+		want  string
+	}{
+		{grace: time.Second, want: "started\ngoodbye\n"},
+		// Without a grace period the program is killed before it can flush.
+		{grace: 0, want: "started\n"},
+	} {
+		fc := newFakeClient(t)
+		fc.program = func(c *fakeContainer) fakeExit {
+			return fakeExit{
+				output: []fakeChunk{outChunk("started\n")},
+				hang:   true,
+				onTerm: []fakeChunk{outChunk("goodbye\n")},
+			}
+		}
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Timeout = 100 * time.Millisecond
+		req.StopGracePeriod = tt.grace
+		result, err := r.Run(context.Background(), req)
+		if err != nil {
+			t.Fatalf("StopGracePeriod=%s: Run: %v", tt.grace, err)
+		}
+		if !result.TimedOut || result.Stdout != tt.want {
+			t.Errorf("StopGracePeriod=%s: TimedOut = %t, Stdout = %q, want %q", tt.grace, result.TimedOut, result.Stdout, tt.want)
+		}
+	}
+
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+	req := fakeRequest()
+	req.StopGracePeriod = -time.Second
+	if _, err := r.Run(context.Background(), req); err == nil {
+		t.Error("Run accepted a negative grace period")
+	}
+}
+
+func TestRunStopGracePeriodDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte(`import signal, sys, time
+
+def goodbye(signum, frame):
+    print("goodbye", flush=True)
+    sys.exit(0)
+
+signal.signal(signal.SIGTERM, goodbye)
+print("started", flush=True)
+while True:
+    time.sleep(0.1)
+`),
+		},
+		Timeout:         time.Second,
+		StopGracePeriod: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.TimedOut || result.Stdout != "started\ngoodbye\n" {
+		t.Errorf("TimedOut = %t, Stdout = %q, want the goodbye printed after SIGTERM", result.TimedOut, result.Stdout)
+	}
+}
+
+func TestRunMemoryLimit(t *testing.T) {
+	tests := []struct {
+		memory int64
+		want   int64
+	}{
+		{memory: 0, want: defaultMemoryBytes},
+		{memory: 64 << 20, want: 64 << 20},
+		// Docker reads zero as no limit.
+		{memory: UnlimitedMemory, want: 0},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.MemoryBytes = tt.memory
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("MemoryBytes=%d: Run: %v", tt.memory, err)
+		}
+		resources := fc.last().hostConfig.Resources
+		if resources.Memory != tt.want || resources.MemorySwap != tt.want {
+			t.Errorf("MemoryBytes=%d: Memory = %d, MemorySwap = %d, want %d", tt.memory, resources.Memory, resources.MemorySwap, tt.want)
+		}
+	}
+}
+
+func TestRunMemoryLimitBelowMinimum(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	// Negative limits other than UnlimitedMemory are not taken as unlimited.
+	for _, memory := range []int64{1 << 20, -2} {
+		req := fakeRequest()
+		req.MemoryBytes = memory
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run succeeded with a memory limit of %d bytes", memory)
+		}
+	}
+}
+
+func TestRunCPUQuota(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.CPUs = 0.5
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	resources := fc.last().hostConfig.Resources
+	if resources.CPUPeriod != 100_000 || resources.CPUQuota != 50_000 {
+		t.Errorf("CPUPeriod = %d, CPUQuota = %d, want 100000 and 50000", resources.CPUPeriod, resources.CPUQuota)
+	}
+}
+
+func TestRunPidsLimit(t *testing.T) {
+	tests := []struct {
+		pids int64
+		want int64
+	}{
+		{pids: 0, want: defaultPidsLimit},
+		{pids: 16, want: 16},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.PidsLimit = tt.pids
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("PidsLimit=%d: Run: %v", tt.pids, err)
+		}
+		if got := fc.last().hostConfig.PidsLimit; got == nil || *got != tt.want {
+			t.Errorf("PidsLimit=%d: HostConfig PidsLimit = %v, want %d", tt.pids, got, tt.want)
+		}
+	}
+}
+
+func TestRunShmSize(t *testing.T) {
+	for _, size := range []int64{0, 256 << 20} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.ShmSize = size
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("ShmSize=%d: Run: %v", size, err)
+		}
+		if got := fc.last().hostConfig.ShmSize; got != size {
+			t.Errorf("ShmSize=%d: HostConfig ShmSize = %d", size, got)
+		}
+	}
+
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+	req := fakeRequest()
+	req.ShmSize = -1
+	if _, err := r.Run(context.Background(), req); err == nil {
+		t.Error("Run accepted a negative shm size")
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+}
+
+func TestRunShmSizeDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("import os\ns = os.statvfs('/dev/shm')\nprint(s.f_blocks * s.f_frsize)\n"),
+		},
+		ShmSize: 128 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := strconv.Itoa(128<<20) + "\n"; result.Stdout != want {
+		t.Errorf("Stdout = %q, Stderr = %q, want /dev/shm of %s", result.Stdout, result.Stderr, want)
+	}
+}
+
+func TestRunForkBombDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceDir:   "testdata/forkbomb",
+		MemoryBytes: 64 << 20,
+		PidsLimit:   16,
+		Timeout:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.TimedOut {
+		t.Error("the fork bomb ran into the timeout")
+	}
+	if !strings.Contains(result.Stdout, "fork failed") {
+		t.Errorf("Stdout = %q, want forking to fail", result.Stdout)
+	}
+}
+
+// fakeEcho is a program that runs echo commands, wherever they are in its
+// command line.
+func fakeEcho(c *fakeContainer) fakeExit {
+	cmd := c.config.Cmd
+	for i, arg := range cmd {
+		if arg == "echo" {
+			return fakeExit{output: []fakeChunk{outChunk(strings.Join(cmd[i+1:], " ") + "\n")}}
+		}
+	}
+	return fakeExit{code: 127}
+}
+
+func TestRunCustomCmd(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = fakeEcho
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Cmd = []string{"echo", "custom-marker"}
+	result, err := r.Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(result.Stdout, "custom-marker") {
+		t.Errorf("Stdout = %q, want the marker", result.Stdout)
+	}
+	if cmd := strings.Join(fc.last().config.Cmd, " "); strings.Contains(cmd, timerName) {
+		t.Errorf("Cmd = %q, want the timer wrapper replaced", cmd)
+	}
+}
+
+func TestRunCustomCmdDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("")},
+		Cmd:         []string{"echo", "custom-marker"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "custom-marker\n" {
+		t.Errorf("Stdout = %q, want the marker", result.Stdout)
+	}
+}
+
+func TestRunReadonlyRootfs(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	hostConfig := fc.last().hostConfig
+	if !hostConfig.ReadonlyRootfs {
+		t.Error("ReadonlyRootfs = false, want true")
+	}
+	for _, dir := range []string{"/tmp", codeDir} {
+		if _, ok := hostConfig.Tmpfs[dir]; !ok {
+			t.Errorf("no tmpfs at %s, want it writable", dir)
+		}
+	}
+}
+
+func TestRunReadonlyRootfsDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	source := `
+for path in ["/etc/runner-test", "/tmp/runner-test"]:
+    try:
+        open(path, "w").write("x")
+        print(path, "ok")
+    except OSError:
+        print(path, "failed")
+`
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte(source)},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := "/etc/runner-test failed\n/tmp/runner-test ok\n"
+	if result.Stdout != want {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, want)
+	}
+}
+
+func TestRunDropsCapabilities(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.CapAdd = []string{"NET_BIND_SERVICE"}
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	hostConfig := fc.last().hostConfig
+	if want := []string{"ALL"}; !reflect.DeepEqual([]string(hostConfig.CapDrop), want) {
+		t.Errorf("CapDrop = %v, want %v", hostConfig.CapDrop, want)
+	}
+	if want := []string{"NET_BIND_SERVICE"}; !reflect.DeepEqual([]string(hostConfig.CapAdd), want) {
+		t.Errorf("CapAdd = %v, want %v", hostConfig.CapAdd, want)
+	}
+	if want := []string{"no-new-privileges:true"}; !reflect.DeepEqual(hostConfig.SecurityOpt, want) {
+		t.Errorf("SecurityOpt = %v, want %v", hostConfig.SecurityOpt, want)
+	}
+	if hostConfig.Privileged {
+		t.Error("Privileged = true, want false")
+	}
+}
+
+func TestRunUser(t *testing.T) {
+	for _, user := range []string{"", "2000:2000"} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.User = user
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("User=%q: Run: %v", user, err)
+		}
+		want := user
+		if want == "" {
+			want = defaultUser
+		}
+		if got := fc.last().config.User; got != want {
+			t.Errorf("User=%q: container user = %q, want %q", user, got, want)
+		}
+	}
+}
+
+func TestRunUserDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("")},
+		Cmd:         []string{"id", "-u"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if uid := strings.TrimSpace(result.Stdout); uid == "" || uid == "0" {
+		t.Errorf("id -u printed %q, want a non-zero UID", result.Stdout)
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.Args = []string{"first arg", "$(second)"}
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	cmd := []string(fc.last().config.Cmd)
+	if len(cmd) < 4 || !reflect.DeepEqual(cmd[len(cmd)-3:], []string{"main.py", "first arg", "$(second)"}) {
+		t.Errorf("Cmd = %q, want the args passed as is after main.py", cmd)
+	}
+}
+
+func TestRunArgsDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("import sys\nprint(sys.argv[1:])\n")},
+		Args:        []string{"first arg", "$(second)"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := "['first arg', '$(second)']\n"; result.Stdout != want {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, want)
+	}
+}
+
+func TestRunOOMKilled(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{code: 137, oomKilled: true}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.OOMKilled || result.TimedOut {
+		t.Errorf("OOMKilled = %t, TimedOut = %t, want only OOMKilled", result.OOMKilled, result.TimedOut)
+	}
+}
+
+func TestRunOOMKilledDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceDir:   "testdata/oom",
+		MemoryBytes: 32 << 20,
+		Timeout:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.OOMKilled {
+		t.Errorf("OOMKilled = false with exit code %d, want true", result.ExitCode)
+	}
+}
+
+func TestRunWorkDir(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.WorkDir = "/workspace"
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	c := fc.last()
+	if c.config.WorkingDir != "/workspace" || c.copyDir != "/workspace" {
+		t.Errorf("WorkingDir = %s, copied to %s, want /workspace for both", c.config.WorkingDir, c.copyDir)
+	}
+	if _, ok := c.hostConfig.Tmpfs["/workspace"]; !ok {
+		t.Errorf("Tmpfs = %v, want /workspace writable", c.hostConfig.Tmpfs)
+	}
+}
+
+func TestRunWorkDirDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{"main.py": []byte("import os\nprint(os.getcwd())\n")},
+		WorkDir:     "/workspace",
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Stdout != "/workspace\n" {
+		t.Errorf("Stdout = %q, want %q", result.Stdout, "/workspace\n")
+	}
+}
+
+func TestRunCancelAfterExit(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{outChunk("done\n")}, code: 2}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc.exitHook = cancel
+	r := newTestRunner(fc)
+
+	result, err := r.Run(ctx, fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 2 || result.Stdout != "done\n" {
+		t.Errorf("ExitCode = %d, Stdout = %q, want the complete result", result.ExitCode, result.Stdout)
+	}
+	if n := fc.called("ContainerRemove"); n != 1 {
+		t.Errorf("ContainerRemove called %d times, want 1", n)
+	}
+}
+
+func TestRunBlkio(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	resources := fc.last().hostConfig.Resources
+	if resources.BlkioWeight != 0 || resources.BlkioDeviceReadBps != nil || resources.BlkioDeviceWriteBps != nil {
+		t.Errorf("block IO limits %+v are set by default", resources)
+	}
+
+	req := fakeRequest()
+	req.BlkioWeight = 100
+	req.DiskReadBps = map[string]uint64{"/dev/sdb": 2 << 20, "/dev/sda": 1 << 20}
+	req.DiskWriteBps = map[string]uint64{"/dev/sda": 512 << 10}
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	resources = fc.last().hostConfig.Resources
+	if resources.BlkioWeight != 100 {
+		t.Errorf("BlkioWeight = %d, want 100", resources.BlkioWeight)
+	}
+	read := resources.BlkioDeviceReadBps
+	if len(read) != 2 || *read[0] != (blkiodev.ThrottleDevice{Path: "/dev/sda", Rate: 1 << 20}) || *read[1] != (blkiodev.ThrottleDevice{Path: "/dev/sdb", Rate: 2 << 20}) {
+		t.Errorf("BlkioDeviceReadBps = %v, want both devices sorted by path", read)
+	}
+	write := resources.BlkioDeviceWriteBps
+	if len(write) != 1 || *write[0] != (blkiodev.ThrottleDevice{Path: "/dev/sda", Rate: 512 << 10}) {
+		t.Errorf("BlkioDeviceWriteBps = %v, want /dev/sda at 512KiB/s", write)
+	}
+}
+
+func TestRunValidatesBeforeWork(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RunRequest
+		want error
+	}{
+		{name: "unknown language", req: RunRequest{Language: "cobol"}, want: ErrUnknownLanguage},
+		{name: "negative cpus", req: RunRequest{CPUs: -1}},
+		{name: "negative pids", req: RunRequest{PidsLimit: -1}},
+		{name: "negative output", req: RunRequest{MaxOutputBytes: -1}},
+		{name: "missing source dir", req: RunRequest{SourceDir: "testdata/does-not-exist"}},
+		{name: "auto remove and keep", req: RunRequest{AutoRemove: true, KeepOnFailure: true}},
+		{name: "auto remove and output files", req: RunRequest{AutoRemove: true, OutputFiles: []string{"out.txt"}}},
+		{name: "missing image", req: RunRequest{Image: "missing:1"}, want: ErrImageNotFound},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := tt.req
+		if req.Image == "" {
+			req.Image = fakeImage
+		}
+		if req.SourceDir == "" {
+			req.SourceFiles = fakeRequest().SourceFiles
+		}
+		_, err := r.Run(context.Background(), req)
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: Run error = %v, want %v", tt.name, err, tt.want)
+		}
+		for _, call := range []string{"ImageBuild", "ImagePull", "ContainerCreate"} {
+			if n := fc.called(call); n != 0 {
+				t.Errorf("%s: %s called %d times, want 0", tt.name, call, n)
+			}
+		}
+	}
+}
+
+func TestRunRestartPolicy(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if policy := fc.last().hostConfig.RestartPolicy; policy.Name != "no" {
+		t.Errorf("RestartPolicy = %+v, want no restarts", policy)
+	}
+}
+
+func TestRunRestartPolicyDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	// The failed run's container is kept, so that it can be watched not to
+	// come back.
+	requestID := "restart-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles:   map[string][]byte{"main.py": []byte("raise SystemExit(1)\n")},
+		KeepOnFailure: true,
+		RequestID:     requestID,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 1 {
+		t.Fatalf("ExitCode = %d, want 1", result.ExitCode)
+	}
+	containers, err := r.dc.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelRequestID+"="+requestID)),
+	})
+	if err != nil || len(containers) != 1 {
+		t.Fatalf("found %d containers of the run: %v", len(containers), err)
+	}
+	id := containers[0].ID
+	defer disposeContainer(context.Background(), r.dc, id)
+
+	time.Sleep(2 * time.Second)
+	info, err := r.dc.ContainerInspect(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Status != "exited" || info.RestartCount != 0 {
+		t.Errorf("container is %s after %d restarts, want it exited and never restarted", info.State.Status, info.RestartCount)
+	}
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// seccompProfile is the part of a seccomp profile the tests look at.
+type seccompProfile struct {
+	DefaultAction string `json:"defaultAction"`
+	Syscalls      []struct {
+		Names  []string `json:"names"`
+		Action string   `json:"action"`
+	} `json:"syscalls"`
+}
+
+func TestStrictSeccompProfileKills(t *testing.T) {
+	var profile seccompProfile
+	if err := json.Unmarshal([]byte(StrictSeccompProfile), &profile); err != nil {
+		t.Fatalf("parse profile: %v", err)
+	}
+
+	actions := make(map[string][]string)
+	for _, rule := range profile.Syscalls {
+		for _, name := range rule.Names {
+			actions[name] = append(actions[name], rule.Action)
+		}
+	}
+	for _, name := range []string{"mount", "ptrace", "keyctl"} {
+		if got := actions[name]; len(got) != 1 || got[0] != "SCMP_ACT_KILL_PROCESS" {
+			t.Errorf("%s has the actions %v, want only SCMP_ACT_KILL_PROCESS", name, got)
+		}
+	}
+	if got := actions["read"]; len(got) == 0 || got[0] != "SCMP_ACT_ALLOW" {
+		t.Errorf("read has the actions %v, want it allowed", got)
+	}
+}
+
+func TestRunSeccompProfile(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.SeccompProfile = StrictSeccompProfile
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	opts := fc.last().hostConfig.SecurityOpt
+	if len(opts) != 2 || opts[1] != "seccomp="+StrictSeccompProfile {
+		t.Errorf("SecurityOpt does not apply the profile: %.100q", opts)
+	}
+}
+
+func TestRunSeccompProfileDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	tests := []struct {
+		source string
+		killed bool
+	}{
+		{source: "print('survived')\n"},
+		{
+			source: "import ctypes\nctypes.CDLL(None).ptrace(0, 0, 0, 0)\nprint('survived')\n",
+			killed: true,
+		},
+	}
+	for _, tt := range tests {
+		result, err := r.Run(context.Background(), RunRequest{
+			SourceFiles:    map[string][]byte{"main.py": []byte(tt.source)},
+			SeccompProfile: StrictSeccompProfile,
+		})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		survived := strings.Contains(result.Stdout, "survived")
+		if tt.killed && (survived || result.ExitCode == 0) {
+			t.Errorf("%q exited with %d, want it killed", tt.source, result.ExitCode)
+		}
+		if !tt.killed && (!survived || result.ExitCode != 0) {
+			t.Errorf("%q exited with %d, want it to run fine", tt.source, result.ExitCode)
+		}
+	}
+}
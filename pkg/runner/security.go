@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// WithStrictIsolation refuses to run anything on a daemon whose containers
+// are not isolated from the host's root user, i.e. that runs neither rootless
+// nor with user namespace remapping, failing runs with ErrUnsafeDaemon. The
+// daemon is checked on the first run and again until a check succeeds.
+func WithStrictIsolation() Option {
+	return func(r *Runner) {
+		r.strict = true
+	}
+}
+
+// SecurityWarnings inspects the daemon and returns advisory findings about
+// how well submitted code is isolated from the host, e.g. to log them at
+// startup. None are returned for a rootless or user-namespaced daemon.
+func (r *Runner) SecurityWarnings(ctx context.Context) ([]string, error) {
+	info, err := r.dc.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("daemon info: %w", err)
+	}
+
+	var rootless, userns bool
+	for _, opt := range info.SecurityOptions {
+		switch {
+		case strings.Contains(opt, "name=rootless"):
+			rootless = true
+		case strings.Contains(opt, "name=userns"):
+			userns = true
+		}
+	}
+	if rootless || userns {
+		return nil, nil
+	}
+	return []string{
+		"the daemon runs as root without user namespace remapping, so root in a container is root on the host should the program escape it",
+	}, nil
+}
+
+// checkIsolation fails with ErrUnsafeDaemon when WithStrictIsolation is set and
+// SecurityWarnings finds anything.
+func (r *Runner) checkIsolation(ctx context.Context) error {
+	if !r.strict {
+		return nil
+	}
+	r.mu.Lock()
+	checked := r.isolated
+	r.mu.Unlock()
+	if checked {
+		return nil
+	}
+
+	warnings, err := r.SecurityWarnings(ctx)
+	if err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnsafeDaemon, strings.Join(warnings, "; "))
+	}
+
+	r.mu.Lock()
+	r.isolated = true
+	r.mu.Unlock()
+	return nil
+}
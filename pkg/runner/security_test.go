@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSecurityWarnings(t *testing.T) {
+	tests := []struct {
+		options []string
+		warned  bool
+	}{
+		{options: []string{"name=seccomp,profile=builtin"}, warned: true},
+		{options: []string{"name=seccomp,profile=builtin", "name=rootless"}},
+		{options: []string{"name=userns"}},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		fc.info.SecurityOptions = tt.options
+		r := newTestRunner(fc)
+
+		warnings, err := r.SecurityWarnings(context.Background())
+		if err != nil {
+			t.Fatalf("SecurityWarnings: %v", err)
+		}
+		if warned := len(warnings) > 0; warned != tt.warned {
+			t.Errorf("SecurityOptions %q: warnings = %q, want some %t", tt.options, warnings, tt.warned)
+		}
+	}
+}
+
+func TestRunStrictIsolation(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.info.SecurityOptions = []string{"name=seccomp,profile=builtin"}
+	r := newTestRunner(fc, WithStrictIsolation())
+
+	if _, err := r.Run(context.Background(), fakeRequest()); !errors.Is(err, ErrUnsafeDaemon) {
+		t.Errorf("Run error = %v, want ErrUnsafeDaemon", err)
+	}
+	if n := fc.called("ContainerCreate"); n != 0 {
+		t.Errorf("ContainerCreate called %d times, want 0", n)
+	}
+
+	// Once the daemon is remapped, runs go ahead and it is not asked again.
+	fc.mu.Lock()
+	fc.info.SecurityOptions = append(fc.info.SecurityOptions, "name=userns")
+	fc.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+			t.Fatalf("Run on an isolated daemon: %v", err)
+		}
+	}
+	if n := fc.called("Info"); n != 2 {
+		t.Errorf("Info called %d times, want 2", n)
+	}
+
+	// Without strict mode nothing is checked.
+	fc = newFakeClient(t)
+	r = newTestRunner(fc)
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := fc.called("Info"); n != 0 {
+		t.Errorf("Info called %d times without strict isolation, want 0", n)
+	}
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// ResultSink persists the result of every successful run, e.g. for
+// analytics. Implementations must be safe for concurrent use.
+type ResultSink interface {
+	// Record is called with the result of a run once it is over. A failing
+	// Record is logged but does not fail the run. ctx is not the run's own,
+	// which may be done already, but bounds recording to a few seconds.
+	Record(ctx context.Context, result RunResult) error
+}
+
+// noSink discards all results.
+type noSink struct{}
+
+func (noSink) Record(context.Context, RunResult) error { return nil }
+
+// WithResultSink records the result of every successful run to s. A nil s
+// disables recording.
+func WithResultSink(s ResultSink) Option {
+	return func(r *Runner) {
+		if s == nil {
+			s = noSink{}
+		}
+		r.sink = s
+	}
+}
+
+// JSONLSink writes the metadata of every result as a line of JSON to a file.
+// The program's output is left out.
+type JSONLSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONLSink returns a JSONLSink appending to the file at path, creating it
+// if needed.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{f: f}, nil
+}
+
+// runRecord is the line JSONLSink writes for a result.
+type runRecord struct {
+	RequestID       string `json:"request_id"`
+	Language        string `json:"language"`
+	ExitCode        int    `json:"exit_code"`
+	WallTimeMs      int64  `json:"wall_time_ms"`
+	ElapsedMs       int64  `json:"elapsed_ms"`
+	CPUTimeMs       int64  `json:"cpu_time_ms"`
+	PeakMemoryBytes int64  `json:"peak_memory_bytes"`
+	TimedOut        bool   `json:"timed_out"`
+	OOMKilled       bool   `json:"oom_killed"`
+	OutputTruncated bool   `json:"output_truncated"`
+	CompileFailed   bool   `json:"compile_failed"`
+}
+
+// Record appends the metadata of result to the file. Without a wall time
+// from the timer.sh wrapper, the elapsed time measured by the runner stands
+// in for it.
+func (s *JSONLSink) Record(_ context.Context, result RunResult) error {
+	wallTime := result.WallTime
+	if wallTime == 0 {
+		wallTime = result.Elapsed
+	}
+	line, err := json.Marshal(runRecord{
+		RequestID:       result.RequestID,
+		Language:        result.Language,
+		ExitCode:        result.ExitCode,
+		WallTimeMs:      wallTime.Milliseconds(),
+		ElapsedMs:       result.Elapsed.Milliseconds(),
+		CPUTimeMs:       result.CPUTime.Milliseconds(),
+		PeakMemoryBytes: result.PeakMemoryBytes,
+		TimedOut:        result.TimedOut,
+		OOMKilled:       result.OOMKilled,
+		OutputTruncated: result.OutputTruncated,
+		CompileFailed:   result.CompileFailed,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (s *JSONLSink) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink is a ResultSink keeping the results in memory.
+type memorySink struct {
+	mu      sync.Mutex
+	results []RunResult
+	ctxErrs []error
+	err     error
+}
+
+func (s *memorySink) Record(ctx context.Context, result RunResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, result)
+	s.ctxErrs = append(s.ctxErrs, ctx.Err())
+	return s.err
+}
+
+func TestRunRecordsResult(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{errChunk(timingPrefix + "0.25 0.10 0.02\n")}, code: 137, oomKilled: true}
+	}
+	var sink memorySink
+	r := newTestRunner(fc, WithResultSink(&sink))
+
+	req := fakeRequest()
+	req.RequestID = "req-1"
+	if _, err := r.Run(context.Background(), req); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	req.Language = "cobol"
+	if _, err := r.Run(context.Background(), req); err == nil {
+		t.Fatal("Run of an unknown language succeeded")
+	}
+
+	if len(sink.results) != 1 {
+		t.Fatalf("recorded %d results, want only the successful run's", len(sink.results))
+	}
+	got := sink.results[0]
+	if got.RequestID != "req-1" || got.Language != "python" || got.ExitCode != 137 || !got.OOMKilled || got.WallTime == 0 {
+		t.Errorf("recorded %+v, want the request ID, language, exit code, OOM kill and wall time", got)
+	}
+}
+
+func TestRunRecordsElapsedTime(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{{data: "done\n", delay: 20 * time.Millisecond}}}
+	}
+	var sink memorySink
+	// Without the wrapper there is no wall time, as with node or gcc images.
+	r := newTestRunner(fc, WithTimerScript(""), WithResultSink(&sink))
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.WallTime != 0 || result.Elapsed < 20*time.Millisecond {
+		t.Errorf("WallTime = %s, Elapsed = %s, want only the elapsed time of at least 20ms", result.WallTime, result.Elapsed)
+	}
+	if len(sink.results) != 1 || sink.results[0].Elapsed != result.Elapsed {
+		t.Errorf("recorded %+v, want the elapsed time", sink.results)
+	}
+}
+
+func TestRunRecordsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fc := newFakeClient(t)
+	// The caller gives up right as the program exits.
+	fc.exitHook = cancel
+	var sink memorySink
+	r := newTestRunner(fc, WithResultSink(&sink))
+
+	if _, err := r.Run(ctx, fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(sink.results) != 1 {
+		t.Fatalf("recorded %d results, want the finished run's", len(sink.results))
+	}
+	if err := sink.ctxErrs[0]; err != nil {
+		t.Errorf("Record got a context that is done: %v", err)
+	}
+}
+
+func TestRunSinkFailureDoesNotFailRun(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	fc := newFakeClient(t)
+	r := newTestRunner(fc, WithResultSink(&memorySink{err: errors.New("disk full")}))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Errorf("Run: %v, want the failing sink only logged", err)
+	}
+	if !strings.Contains(logs.String(), "recording result: disk full") {
+		t.Errorf("logs = %q, want the failure logged", logs.String())
+	}
+}
+
+func TestJSONLSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	sink, err := NewJSONLSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := sink.Record(context.Background(), RunResult{RequestID: id, Language: "python", Stdout: "secret", TimedOut: id == "b"}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("the records hold the program's output: %s", b)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(lines))
+	}
+	var record runRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.RequestID != "b" || record.Language != "python" || !record.TimedOut {
+		t.Errorf("second record = %+v, want run b timing out", record)
+	}
+}
+
+func TestJSONLSinkElapsedTime(t *testing.T) {
+	tests := []struct {
+		result   RunResult
+		wallTime int64
+	}{
+		{result: RunResult{WallTime: 250 * time.Millisecond, Elapsed: 400 * time.Millisecond}, wallTime: 250},
+		// Without the wrapper's measurement the elapsed time stands in.
+		{result: RunResult{Elapsed: 400 * time.Millisecond}, wallTime: 400},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "runs.jsonl")
+		sink, err := NewJSONLSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Record(context.Background(), tt.result); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+		sink.Close()
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record runRecord
+		if err := json.Unmarshal(b, &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.WallTimeMs != tt.wallTime || record.ElapsedMs != 400 {
+			t.Errorf("WallTime %s: recorded wall time %dms and elapsed time %dms, want %dms and 400ms", tt.result.WallTime, record.WallTimeMs, record.ElapsedMs, tt.wallTime)
+		}
+	}
+}
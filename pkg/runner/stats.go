@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/docker/api/types"
+)
+
+// samplePeakMemory streams the container's stats until ctx is done or the
+// stream ends, then sends the highest memory usage seen. Zero is sent when
+// stats are unavailable.
+func samplePeakMemory(
+	ctx context.Context,
+	dc DockerClient,
+	containerID string,
+) <-chan int64 {
+	peakCh := make(chan int64, 1)
+
+	go func() {
+		var peak uint64
+		defer func() {
+			peakCh <- int64(peak)
+		}()
+
+		stats, err := dc.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			return
+		}
+		defer stats.Body.Close()
+
+		dec := json.NewDecoder(stats.Body)
+		for {
+			var s types.StatsJSON
+			if err := dec.Decode(&s); err != nil {
+				return
+			}
+
+			// max_usage_in_bytes is only reported on cgroup v1, so fall back
+			// to the highest sampled usage.
+			if s.MemoryStats.MaxUsage > peak {
+				peak = s.MemoryStats.MaxUsage
+			}
+			if s.MemoryStats.Usage > peak {
+				peak = s.MemoryStats.Usage
+			}
+		}
+	}()
+
+	return peakCh
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunPeakMemory(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.memUsage = 30 << 20
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.PeakMemoryBytes != 30<<20 {
+		t.Errorf("PeakMemoryBytes = %d, want %d", result.PeakMemoryBytes, 30<<20)
+	}
+}
+
+func TestRunPeakMemoryWithoutStats(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.statsErr = errors.New("stats unavailable")
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.PeakMemoryBytes != 0 {
+		t.Errorf("PeakMemoryBytes = %d, want 0", result.PeakMemoryBytes)
+	}
+}
+
+func TestRunPeakMemoryDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	// The daemon samples stats about once a second, so the buffer is held
+	// for longer than that.
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("import time\nbuf = bytearray(20 << 20)\ntime.sleep(3)\n"),
+		},
+		MemoryBytes: 64 << 20,
+		Timeout:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.PeakMemoryBytes < 20<<20 || result.PeakMemoryBytes > 64<<20 {
+		t.Errorf("PeakMemoryBytes = %d, want between 20MB and 64MB", result.PeakMemoryBytes)
+	}
+}
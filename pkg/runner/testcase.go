@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TestCase is a single input of a program along with the output it is expected
+// to print for it.
+type TestCase struct {
+	// Input is passed to the program's standard input.
+	Input string
+
+	// ExpectedOutput is compared against the program's standard output.
+	ExpectedOutput string
+
+	// TrimSpace ignores leading and trailing white space of the whole output
+	// and trailing white space of every line when comparing. Outputs must
+	// match exactly otherwise.
+	TrimSpace bool
+}
+
+// CaseResult is the outcome of running a program against a TestCase.
+type CaseResult struct {
+	RunResult
+
+	// Passed reports whether the program printed the expected output and
+	// exited with status zero by itself, within its time, memory and output
+	// limits.
+	Passed bool
+}
+
+// RunTestCases runs req once for every test case, with the case's input as
+// standard input, one case at a time. Results are returned in the order of
+// cases. A run failing to execute does not stop the remaining cases: its
+// result is left zero, which does not pass, and the returned error joins the
+// errors of all failed runs, each naming the index of its case.
+func (r *Runner) RunTestCases(ctx context.Context, req RunRequest, cases []TestCase) ([]CaseResult, error) {
+	var (
+		results = make([]CaseResult, len(cases))
+		errs    []error
+	)
+	for i, tc := range cases {
+		req.Stdin = strings.NewReader(tc.Input)
+		result, err := r.Run(ctx, req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("case %d: %w", i, err))
+			continue
+		}
+		results[i] = CaseResult{
+			RunResult: result,
+			Passed:    passed(tc, result),
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// passed reports whether result passes tc.
+func passed(tc TestCase, result RunResult) bool {
+	if result.ExitCode != 0 || result.Err() != nil || result.OutputTruncated {
+		return false
+	}
+	if tc.TrimSpace {
+		return trimOutput(result.Stdout) == trimOutput(tc.ExpectedOutput)
+	}
+	return result.Stdout == tc.ExpectedOutput
+}
+
+// trimOutput strips trailing white space from every line of s, and leading and
+// trailing white space from s as a whole.
+func trimOutput(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
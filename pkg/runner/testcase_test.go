@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeDouble is a program printing twice the number it reads from stdin.
+func fakeDouble(c *fakeContainer) fakeExit {
+	n, err := strconv.Atoi(strings.TrimSpace(c.stdin.String()))
+	if err != nil {
+		return fakeExit{output: []fakeChunk{errChunk(err.Error() + "\n")}, code: 1}
+	}
+	return fakeExit{output: []fakeChunk{outChunk(strconv.Itoa(n*2) + "\n")}}
+}
+
+func TestRunTestCases(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = fakeDouble
+	r := newTestRunner(fc)
+
+	cases := []TestCase{
+		{Input: "5\n", ExpectedOutput: "10\n"},
+		{Input: "3\n", ExpectedOutput: "7\n"},
+		{Input: "2\n", ExpectedOutput: "4  \n\n", TrimSpace: true},
+		{Input: "x\n", ExpectedOutput: ""},
+	}
+	results, err := r.RunTestCases(context.Background(), fakeRequest(), cases)
+	if err != nil {
+		t.Fatalf("RunTestCases: %v", err)
+	}
+	for i, want := range []bool{true, false, true, false} {
+		if results[i].Passed != want {
+			t.Errorf("case %d: Passed = %t with Stdout %q, want %t", i, results[i].Passed, results[i].Stdout, want)
+		}
+	}
+	if results[1].Stdout != "6\n" {
+		t.Errorf("case 1: Stdout = %q, want the actual output", results[1].Stdout)
+	}
+}
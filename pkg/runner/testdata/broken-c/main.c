@@ -0,0 +1,6 @@
+#include <stdio.h>
+
+int main(void) {
+	printf("ran\n")
+	return 0;
+}
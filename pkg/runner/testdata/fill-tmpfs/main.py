@@ -0,0 +1,15 @@
+import errno
+
+written = 0
+try:
+    with open("/code/fill.bin", "wb") as f:
+        while written < 64 << 20:
+            f.write(b"\0" * 65536)
+            f.flush()
+            written += 65536
+except OSError as e:
+    if e.errno not in (errno.ENOSPC, errno.EFBIG):
+        raise
+    print("full after", written)
+else:
+    print("wrote", written)
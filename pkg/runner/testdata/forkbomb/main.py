@@ -0,0 +1,12 @@
+import os
+import time
+
+children = 0
+try:
+    while True:
+        if os.fork() == 0:
+            time.sleep(10)
+            os._exit(0)
+        children += 1
+except OSError:
+    print("fork failed after", children, "children")
@@ -0,0 +1,12 @@
+import errno
+
+files = []
+try:
+    for _ in range(5000):
+        files.append(open("/dev/null"))
+except OSError as e:
+    if e.errno != errno.EMFILE:
+        raise
+    print("EMFILE after", len(files))
+else:
+    print("opened", len(files))
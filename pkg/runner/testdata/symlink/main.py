@@ -0,0 +1 @@
+print(open("passwd").read())
@@ -0,0 +1,3 @@
+from lib import calc
+
+print(calc.ratio(1, 0))
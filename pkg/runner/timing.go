@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timingPrefix starts the line timer.sh writes to stderr with the wall-clock,
+// user and system seconds of the program.
+const timingPrefix = "__RUNNER_TIMING__ "
+
+// extractTiming removes the last timing line written by timer.sh from output
+// and returns the remaining output along with the parsed wall-clock and CPU
+// time. Output without a well-formed timing line is returned unchanged with
+// zero durations.
+func extractTiming(output string) (string, time.Duration, time.Duration) {
+	start := strings.LastIndex(output, timingPrefix)
+	if start < 0 || (start > 0 && output[start-1] != '\n') {
+		return output, 0, 0
+	}
+
+	end := strings.IndexByte(output[start:], '\n')
+	if end < 0 {
+		end = len(output)
+	} else {
+		end += start + 1
+	}
+
+	fields := strings.Fields(output[start+len(timingPrefix) : end])
+	if len(fields) != 3 {
+		return output, 0, 0
+	}
+
+	var seconds [3]float64
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return output, 0, 0
+		}
+		seconds[i] = v
+	}
+
+	var (
+		wallTime = time.Duration(seconds[0] * float64(time.Second))
+		cpuTime  = time.Duration((seconds[1] + seconds[2]) * float64(time.Second))
+	)
+	return output[:start] + output[end:], wallTime, cpuTime
+}
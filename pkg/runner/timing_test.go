@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunReportsTiming(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{output: []fakeChunk{
+			errChunk("warning\n"),
+			errChunk(timingPrefix + "1.01 0.02 0.01\n"),
+		}}
+	}
+	r := newTestRunner(fc)
+
+	result, err := r.Run(context.Background(), fakeRequest())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.WallTime < time.Second {
+		t.Errorf("WallTime = %s, want at least 1s", result.WallTime)
+	}
+	if result.CPUTime != 30*time.Millisecond {
+		t.Errorf("CPUTime = %s, want 30ms", result.CPUTime)
+	}
+	if result.Stderr != "warning\n" {
+		t.Errorf("Stderr = %q, want the timing line stripped", result.Stderr)
+	}
+}
+
+func TestRunReportsTimingDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceFiles: map[string][]byte{
+			"main.py": []byte("import time\ntime.sleep(1)\n"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.WallTime < time.Second {
+		t.Errorf("WallTime = %s, want at least 1s", result.WallTime)
+	}
+	if result.Stderr != "" {
+		t.Errorf("Stderr = %q, want the timing line stripped", result.Stderr)
+	}
+}
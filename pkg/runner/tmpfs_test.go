@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunTmpfsSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  map[string]string
+	}{
+		{want: map[string]string{"/tmp": "size=67108864", codeDir: "size=67108864,exec"}},
+		{bytes: 1 << 20, want: map[string]string{"/tmp": "size=1048576", codeDir: "size=1048576,exec"}},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.TmpfsBytes = tt.bytes
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if got := fc.last().hostConfig.Tmpfs; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TmpfsBytes %d: Tmpfs = %v, want %v", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestRunTmpfsOverflow(t *testing.T) {
+	fc := newFakeClient(t)
+	r := newTestRunner(fc)
+
+	req := fakeRequest()
+	req.TmpfsBytes = 1024
+	req.SourceFiles["data.txt"] = []byte(strings.Repeat("x", 4096))
+	_, err := r.Run(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "No space left on device") {
+		t.Fatalf("Run error = %v, want the full tmpfs to fail the run", err)
+	}
+	if n := fc.called("ContainerRemove"); n != 1 {
+		t.Errorf("ContainerRemove called %d times, want 1", n)
+	}
+}
+
+func TestRunTmpfsOverflowDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{
+		SourceDir:  "testdata/fill-tmpfs",
+		TmpfsBytes: 4 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	written, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(result.Stdout, "full after")))
+	if err != nil || written > 4<<20 {
+		t.Errorf("Stdout = %q, want the writes to fail within the 4 MiB tmpfs", result.Stdout)
+	}
+}
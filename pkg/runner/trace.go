@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"strings"
+)
+
+// Tracer starts spans around the phases of a run, e.g. by adapting an
+// OpenTelemetry trace.Tracer. Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, if any,
+	// and returns a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute such as the language or exit code.
+	SetAttribute(key string, value any)
+
+	// End ends the span, recording err unless it is nil.
+	End(err error)
+}
+
+// noTracer starts spans that record nothing.
+type noTracer struct{}
+
+func (noTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noSpan{}
+}
+
+type noSpan struct{}
+
+func (noSpan) SetAttribute(string, any) {}
+func (noSpan) End(error)                {}
+
+// WithTracer traces every run, and each of its phases, with t. A nil t
+// disables tracing.
+func WithTracer(t Tracer) Option {
+	return func(r *Runner) {
+		if t == nil {
+			t = noTracer{}
+		}
+		r.tracer = t
+	}
+}
+
+// phases traces the consecutive phases of a run, each in its own span.
+type phases struct {
+	ctx     context.Context
+	tracer  Tracer
+	span    Span
+	current string
+}
+
+// next ends the current phase and starts the phase called name.
+func (p *phases) next(name string) {
+	p.end(nil)
+	_, p.span = p.tracer.Start(p.ctx, name)
+	p.current = name
+}
+
+// name returns the name of the current phase without its "runner." prefix,
+// or "prepare" before the first one.
+func (p *phases) name() string {
+	if p.current == "" {
+		return "prepare"
+	}
+	return strings.TrimPrefix(p.current, "runner.")
+}
+
+// end ends the current phase, if any, recording err.
+func (p *phases) end(err error) {
+	if p.span != nil {
+		p.span.End(err)
+		p.span = nil
+	}
+}
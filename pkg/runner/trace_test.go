@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// memorySpan is a span recorded by memoryTracer.
+type memorySpan struct {
+	name   string
+	parent *memorySpan
+	attrs  map[string]any
+	ended  bool
+	err    error
+}
+
+func (s *memorySpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+
+func (s *memorySpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type spanKey struct{}
+
+// memoryTracer is a Tracer recording its spans in the order they start, as an
+// in-memory exporter would.
+type memoryTracer struct {
+	mu    sync.Mutex
+	spans []*memorySpan
+}
+
+func (tr *memoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*memorySpan)
+	s := &memorySpan{name: name, parent: parent, attrs: make(map[string]any)}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// names returns the names of the spans.
+func (tr *memoryTracer) names() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	names := make([]string, len(tr.spans))
+	for i, s := range tr.spans {
+		names[i] = s.name
+	}
+	return names
+}
+
+func TestRunTracesPhases(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.program = func(c *fakeContainer) fakeExit {
+		return fakeExit{code: 3}
+	}
+	var tr memoryTracer
+	r := newTestRunner(fc, WithTracer(&tr))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{
+		"runner.run",
+		"runner.ensure_image",
+		"runner.load_source",
+		"runner.create_container",
+		"runner.build_tar",
+		"runner.start",
+		"runner.ready",
+		"runner.copy",
+		"runner.wait",
+		"runner.collect_logs",
+		"runner.finish",
+	}
+	if got := tr.names(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("spans = %v, want %v", got, want)
+	}
+
+	run := tr.spans[0]
+	for _, s := range tr.spans {
+		if !s.ended || s.err != nil {
+			t.Errorf("span %s ended %t with the error %v, want it ended without one", s.name, s.ended, s.err)
+		}
+		if s != run && s.parent != run {
+			t.Errorf("span %s is not a child of runner.run", s.name)
+		}
+	}
+	if run.attrs["runner.language"] != "python" || run.attrs["runner.exit_code"] != 3 {
+		t.Errorf("runner.run has the attributes %v, want the language and exit code", run.attrs)
+	}
+}
+
+func TestRunTracesFailedPhase(t *testing.T) {
+	fc := newFakeClient(t)
+	fc.startErrs = []error{errors.New("start failed")}
+	var tr memoryTracer
+	r := newTestRunner(fc, WithTracer(&tr))
+
+	if _, err := r.Run(context.Background(), fakeRequest()); err == nil {
+		t.Fatal("Run succeeded despite the start failing")
+	}
+	for _, s := range tr.spans {
+		if failed := s.err != nil; failed != (s.name == "runner.start" || s.name == "runner.run") {
+			t.Errorf("span %s ended with the error %v", s.name, s.err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/docker/go-units"
+)
+
+// Ulimit is a resource limit of the program, as set by setrlimit.
+type Ulimit struct {
+	// Name is the resource without its RLIMIT_ prefix, in lower case, e.g.
+	// "nofile" or "fsize".
+	Name string
+
+	// Soft is the limit the program runs with. Hard is the ceiling up to
+	// which the program may raise it. Hard defaults to Soft when zero.
+	Soft int64
+	Hard int64
+}
+
+// defaultUlimits apply unless RunRequest.Ulimits sets the same resource.
+var defaultUlimits = []Ulimit{
+	{Name: "nofile", Soft: 256},
+	{Name: "fsize", Soft: 16 << 20},
+}
+
+// ulimits merges limits into defaultUlimits, limits taking precedence, and
+// returns them sorted by name.
+func ulimits(limits []Ulimit) ([]*units.Ulimit, error) {
+	byName := make(map[string]Ulimit, len(defaultUlimits)+len(limits))
+	for _, l := range defaultUlimits {
+		byName[l.Name] = l
+	}
+	for _, l := range limits {
+		if _, err := units.ParseUlimit(fmt.Sprintf("%s=%d", l.Name, l.Soft)); err != nil {
+			return nil, err
+		}
+		if l.Hard != 0 && l.Hard < l.Soft {
+			return nil, fmt.Errorf("ulimit %s: soft limit %d exceeds hard limit %d", l.Name, l.Soft, l.Hard)
+		}
+		byName[l.Name] = l
+	}
+
+	result := make([]*units.Ulimit, 0, len(byName))
+	for _, l := range byName {
+		hard := l.Hard
+		if hard == 0 {
+			hard = l.Soft
+		}
+		result = append(result, &units.Ulimit{
+			Name: l.Name,
+			Soft: l.Soft,
+			Hard: hard,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
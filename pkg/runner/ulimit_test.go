@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-units"
+)
+
+func TestRunUlimits(t *testing.T) {
+	tests := []struct {
+		limits []Ulimit
+		want   []*units.Ulimit
+	}{
+		{
+			want: []*units.Ulimit{
+				{Name: "fsize", Soft: 16 << 20, Hard: 16 << 20},
+				{Name: "nofile", Soft: 256, Hard: 256},
+			},
+		},
+		{
+			limits: []Ulimit{{Name: "nofile", Soft: 64, Hard: 128}, {Name: "nproc", Soft: 32}},
+			want: []*units.Ulimit{
+				{Name: "fsize", Soft: 16 << 20, Hard: 16 << 20},
+				{Name: "nofile", Soft: 64, Hard: 128},
+				{Name: "nproc", Soft: 32, Hard: 32},
+			},
+		},
+	}
+	for _, tt := range tests {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Ulimits = tt.limits
+		if _, err := r.Run(context.Background(), req); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if got := fc.last().hostConfig.Ulimits; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Ulimits %v: HostConfig.Ulimits = %v, want %v", tt.limits, got, tt.want)
+		}
+	}
+}
+
+func TestRunUlimitsRejects(t *testing.T) {
+	for _, limit := range []Ulimit{
+		{Name: "files", Soft: 10},
+		{Name: "nofile", Soft: 20, Hard: 10},
+	} {
+		fc := newFakeClient(t)
+		r := newTestRunner(fc)
+
+		req := fakeRequest()
+		req.Ulimits = []Ulimit{limit}
+		if _, err := r.Run(context.Background(), req); err == nil {
+			t.Errorf("Run accepted the ulimit %+v", limit)
+		}
+		if n := fc.called("ContainerCreate"); n != 0 {
+			t.Errorf("%+v: ContainerCreate called %d times, want 0", limit, n)
+		}
+	}
+}
+
+func TestRunNofileDocker(t *testing.T) {
+	r := newDockerRunner(t)
+
+	result, err := r.Run(context.Background(), RunRequest{SourceDir: "testdata/nofile"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(result.Stdout, "EMFILE after")))
+	if err != nil || n >= 256 || result.ExitCode != 0 {
+		t.Errorf("Stdout = %q, ExitCode = %d, want EMFILE before 256 files and a clean exit", result.Stdout, result.ExitCode)
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/mtstnt/runner/pkg/runner"
+)
+
+// fakeProgram is what the fake daemon runs: given the program's stdin, it
+// returns its output and exit code.
+type fakeProgram func(stdin string) (stdout, stderr string, code int)
+
+// fakeDocker is a runner.DockerClient standing in for a daemon with every
+// image present. It runs a single container at a time, which plays program
+// once the submission has been extracted into it and its stdin is closed.
+type fakeDocker struct {
+	pingClient
+
+	program   fakeProgram
+	createErr error
+
+	mu         sync.Mutex
+	config     *container.Config
+	hostConfig *container.HostConfig
+	state      string
+	exitCode   int
+	stdin      bytes.Buffer
+	pending    sync.WaitGroup
+	logR       *io.PipeReader
+	logW       *io.PipeWriter
+	done       chan struct{}
+}
+
+// newFakeServer returns a test server running submissions through a runner
+// on fd.
+func newFakeServer(t *testing.T, fd *fakeDocker) *httptest.Server {
+	t.Helper()
+	r := runner.New(fd,
+		runner.WithBuildContext("../../runner", ""),
+		runner.WithTimerScript("../../runner/timer.sh"),
+	)
+	ts := httptest.NewServer(New(r))
+	t.Cleanup(func() {
+		ts.Close()
+		r.Close()
+	})
+	return ts
+}
+
+// created returns the configuration of the container last created.
+func (fd *fakeDocker) created() (*container.Config, *container.HostConfig) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.config, fd.hostConfig
+}
+
+func (fd *fakeDocker) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	return []types.ImageSummary{{
+		ID:       "sha256:fake",
+		RepoTags: options.Filters.Get("reference"),
+	}}, nil
+}
+
+func (fd *fakeDocker) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.createErr != nil {
+		return container.CreateResponse{}, fd.createErr
+	}
+
+	fd.config, fd.hostConfig = config, hostConfig
+	fd.state = "created"
+	fd.logR, fd.logW = io.Pipe()
+	fd.done = make(chan struct{})
+	// The program waits for its submission, and for its stdin if open.
+	fd.pending.Add(1)
+	if config.OpenStdin {
+		fd.pending.Add(1)
+	}
+	go fd.execute()
+	return container.CreateResponse{ID: "fake"}, nil
+}
+
+// execute plays the program once the container is ready for it.
+func (fd *fakeDocker) execute() {
+	fd.pending.Wait()
+	fd.mu.Lock()
+	stdin := fd.stdin.String()
+	logW := fd.logW
+	fd.mu.Unlock()
+
+	stdout, stderr, code := fd.program(stdin)
+	if stdout != "" {
+		io.WriteString(stdcopy.NewStdWriter(logW, stdcopy.Stdout), stdout)
+	}
+	if stderr != "" {
+		io.WriteString(stdcopy.NewStdWriter(logW, stdcopy.Stderr), stderr)
+	}
+	logW.Close()
+
+	fd.mu.Lock()
+	fd.state = "exited"
+	fd.exitCode = code
+	fd.mu.Unlock()
+	close(fd.done)
+}
+
+func (fd *fakeDocker) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.state == "created" {
+		fd.state = "running"
+	}
+	return nil
+}
+
+func (fd *fakeDocker) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	wr := make(chan container.WaitResponse, 1)
+	errCh := make(chan error, 1)
+	fd.mu.Lock()
+	done := fd.done
+	fd.mu.Unlock()
+	go func() {
+		select {
+		case <-done:
+			fd.mu.Lock()
+			wr <- container.WaitResponse{StatusCode: int64(fd.exitCode)}
+			fd.mu.Unlock()
+		case <-ctx.Done():
+			errCh <- ctx.Err()
+		}
+	}()
+	return wr, errCh
+}
+
+// ContainerStop lets the program finish, as it never runs for long.
+func (fd *fakeDocker) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	return nil
+}
+
+func (fd *fakeDocker) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	return nil
+}
+
+func (fd *fakeDocker) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: containerID,
+			State: &types.ContainerState{
+				Status:   fd.state,
+				Running:  fd.state == "running",
+				ExitCode: fd.exitCode,
+			},
+			HostConfig: fd.hostConfig,
+		},
+		Config: fd.config,
+	}, nil
+}
+
+func (fd *fakeDocker) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.logR, nil
+}
+
+func (fd *fakeDocker) ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	var s types.StatsJSON
+	s.MemoryStats.Usage = 1 << 20
+	b, err := json.Marshal(s)
+	if err != nil {
+		return types.ContainerStats{}, err
+	}
+	return types.ContainerStats{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+// ContainerAttach takes the program's stdin.
+func (fd *fakeDocker) ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	inR, inW := io.Pipe()
+	go func() {
+		b, _ := io.ReadAll(inR)
+		fd.mu.Lock()
+		fd.stdin.Write(b)
+		fd.mu.Unlock()
+		fd.pending.Done()
+	}()
+	return hijacked(strings.NewReader(""), inW), nil
+}
+
+func (fd *fakeDocker) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+// ContainerExecAttach extracts the submission, discarding it.
+func (fd *fakeDocker) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		io.Copy(io.Discard, inR)
+		outW.Close()
+		fd.pending.Done()
+	}()
+	return hijacked(outR, inW), nil
+}
+
+func (fd *fakeDocker) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	return types.ContainerExecInspect{ExecID: execID}, nil
+}
+
+func (fd *fakeDocker) Close() error {
+	return nil
+}
+
+// fakeConn is the connection of a hijacked response.
+type fakeConn struct {
+	r io.Reader
+	w io.WriteCloser
+}
+
+// hijacked returns a hijacked response reading from r and writing to w.
+func hijacked(r io.Reader, w io.WriteCloser) types.HijackedResponse {
+	return types.HijackedResponse{
+		Conn:   &fakeConn{r: r, w: w},
+		Reader: bufio.NewReader(r),
+	}
+}
+
+func (c *fakeConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *fakeConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c *fakeConn) CloseWrite() error           { return c.w.Close() }
+
+func (c *fakeConn) Close() error {
+	c.CloseWrite()
+	if pr, ok := c.r.(*io.PipeReader); ok {
+		pr.Close()
+	}
+	return nil
+}
+
+func (c *fakeConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeConn) RemoteAddr() net.Addr               { return nil }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
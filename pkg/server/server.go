@@ -0,0 +1,277 @@
+// Package server exposes a runner.Runner over HTTP.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mtstnt/runner/pkg/runner"
+)
+
+const (
+	maxBodyBytes   = 10 << 20
+	defaultTimeout = 10 * time.Second
+	maxTimeout     = 60 * time.Second
+
+	// Upper bounds of the limits a client may ask for. Larger values are
+	// clamped to these, as the output in particular is held in memory.
+	maxMemoryBytes = 512 << 20
+	maxCPUs        = 4
+	maxOutputBytes = 8 << 20
+
+	// requestOverhead is the time allowed on top of the program's timeout
+	// for preparing the container and collecting the result.
+	requestOverhead = 30 * time.Second
+)
+
+// runRequest is the JSON body of POST /run.
+type runRequest struct {
+	Language       string            `json:"language"`
+	Files          map[string]string `json:"files"`
+	EntryFile      string            `json:"entry_file"`
+	Stdin          string            `json:"stdin"`
+	TimeoutMs      int64             `json:"timeout_ms"`
+	MemoryBytes    int64             `json:"memory_bytes"`
+	CPUs           float64           `json:"cpus"`
+	MaxOutputBytes int64             `json:"max_output_bytes"`
+}
+
+// runResponse is the JSON body answering POST /run.
+type runResponse struct {
+	RequestID       string `json:"request_id"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExitCode        int    `json:"exit_code"`
+	TimedOut        bool   `json:"timed_out"`
+	OOMKilled       bool   `json:"oom_killed"`
+	OutputTruncated bool   `json:"output_truncated"`
+	PeakMemoryBytes int64  `json:"peak_memory_bytes"`
+	WallTimeMs      int64  `json:"wall_time_ms"`
+	CPUTimeMs       int64  `json:"cpu_time_ms"`
+
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+}
+
+// diagnostic is a runner.Diagnostic in a runResponse.
+type diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// healthResponse is the body of GET /healthz while the daemon is reachable.
+type healthResponse struct {
+	APIVersion string `json:"api_version"`
+	OSType     string `json:"os_type"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves runs of a runner.Runner over HTTP.
+type Server struct {
+	r   *runner.Runner
+	mux *http.ServeMux
+}
+
+// New returns a Server running submissions through r. It serves:
+//
+//	POST /run     runs the submitted files and answers with the result
+//	GET /healthz  answers 200 while the Docker daemon is reachable, 503 otherwise
+//
+// Runs the runner rejects, e.g. for an unknown language or a submission over
+// its limits, are answered with 400, other failed runs with 500.
+//
+// The ID of every run is logged along with its outcome and returned in the
+// X-Request-ID response header. An ID passed in the X-Request-ID request
+// header is used instead of a generated one.
+func New(r *runner.Runner) *Server {
+	s := &Server{
+		r:   r,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/run", s.handleRun)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	ping, err := s.r.Ping(req.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, healthResponse{
+		APIVersion: ping.APIVersion,
+		OSType:     ping.OSType,
+	})
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var body runRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err := dec.Decode(&body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(body.Files) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no files submitted"))
+		return
+	}
+
+	// Unlimited memory is for trusted callers only.
+	if body.MemoryBytes < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("memory_bytes may not be negative"))
+		return
+	}
+	if body.CPUs < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("cpus may not be negative"))
+		return
+	}
+	if body.MaxOutputBytes < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("max_output_bytes may not be negative"))
+		return
+	}
+
+	body.MemoryBytes = min64(body.MemoryBytes, maxMemoryBytes)
+	body.MaxOutputBytes = min64(body.MaxOutputBytes, maxOutputBytes)
+	if body.CPUs > maxCPUs {
+		body.CPUs = maxCPUs
+	}
+
+	timeout := time.Duration(body.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if timeout > maxTimeout {
+		writeError(w, http.StatusBadRequest, errors.New("timeout exceeds the maximum of "+maxTimeout.String()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout+requestOverhead)
+	defer cancel()
+
+	runReq := runner.RunRequest{
+		Language:       body.Language,
+		RequestID:      req.Header.Get("X-Request-ID"),
+		SourceFiles:    sourceFiles(body.Files),
+		EntryFile:      body.EntryFile,
+		Timeout:        timeout,
+		MemoryBytes:    body.MemoryBytes,
+		CPUs:           body.CPUs,
+		MaxOutputBytes: body.MaxOutputBytes,
+	}
+	if body.Stdin != "" {
+		runReq.Stdin = strings.NewReader(body.Stdin)
+	}
+
+	result, err := s.r.Run(ctx, runReq)
+	w.Header().Set("X-Request-ID", result.RequestID)
+	if err != nil {
+		log.Printf("request_id=%s language=%q error=%q", result.RequestID, result.Language, err)
+		writeError(w, runErrorStatus(err), err)
+		return
+	}
+	log.Printf("request_id=%s language=%q exit_code=%d timed_out=%t oom_killed=%t wall_time=%s",
+		result.RequestID, result.Language, result.ExitCode, result.TimedOut, result.OOMKilled, result.WallTime)
+
+	writeJSON(w, http.StatusOK, runResponse{
+		RequestID:       result.RequestID,
+		Stdout:          result.Stdout,
+		Stderr:          result.Stderr,
+		ExitCode:        result.ExitCode,
+		TimedOut:        result.TimedOut,
+		OOMKilled:       result.OOMKilled,
+		OutputTruncated: result.OutputTruncated,
+		PeakMemoryBytes: result.PeakMemoryBytes,
+		WallTimeMs:      result.WallTime.Milliseconds(),
+		CPUTimeMs:       result.CPUTime.Milliseconds(),
+		Diagnostics:     diagnostics(result.Diagnostics),
+	})
+}
+
+// runErrorStatus returns the HTTP status answering a failed run: 400 for
+// submissions the runner rejects, 500 for failures of the runner or daemon.
+func runErrorStatus(err error) int {
+	for _, target := range []error{
+		runner.ErrInvalidRequest,
+		runner.ErrUnknownLanguage,
+		runner.ErrAmbiguousLanguage,
+		runner.ErrSourceEmpty,
+		runner.ErrSourceTooLarge,
+	} {
+		if errors.Is(err, target) {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// diagnostics converts the runner's diagnostics for a runResponse.
+func diagnostics(diags []runner.Diagnostic) []diagnostic {
+	converted := make([]diagnostic, len(diags))
+	for i, d := range diags {
+		converted[i] = diagnostic{
+			File:    d.File,
+			Line:    d.Line,
+			Column:  d.Column,
+			Message: d.Message,
+		}
+	}
+	return converted
+}
+
+// sourceFiles converts the submitted text files to the runner's file contents.
+func sourceFiles(files map[string]string) map[string][]byte {
+	sourceFiles := make(map[string][]byte, len(files))
+	for name, contents := range files {
+		sourceFiles[name] = []byte(contents)
+	}
+	return sourceFiles
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// min64 returns the smaller of a and b.
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
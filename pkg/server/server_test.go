@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mtstnt/runner/pkg/runner"
+)
+
+// pingClient is a runner.DockerClient that only answers Ping, failing it with
+// err if set. Its other methods must not be called.
+type pingClient struct {
+	runner.DockerClient
+	err error
+}
+
+func (c pingClient) Ping(ctx context.Context) (types.Ping, error) {
+	if c.err != nil {
+		return types.Ping{}, c.err
+	}
+	return types.Ping{APIVersion: "1.42", OSType: "linux"}, nil
+}
+
+// newDockerServer returns a test server running submissions on the Docker
+// daemon of the environment, skipping the test when there is none or in short
+// mode.
+func newDockerServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("needs a Docker daemon")
+	}
+	r, err := runner.NewFromEnv(
+		runner.WithBuildContext("../../runner", ""),
+		runner.WithTimerScript("../../runner/timer.sh"),
+	)
+	if err != nil {
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := r.Ping(ctx); err != nil {
+		r.Close()
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	ts := httptest.NewServer(New(r))
+	t.Cleanup(func() {
+		ts.Close()
+		r.Close()
+	})
+	return ts
+}
+
+func TestRun(t *testing.T) {
+	ts := newDockerServer(t)
+
+	body := `{"language": "python", "files": {"main.py": "import sys\nprint(input() * 2)\nsys.exit(4)\n"}, "stdin": "ab\n"}`
+	resp, err := http.Post(ts.URL+"/run", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var got runResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Stdout != "abab\n" || got.ExitCode != 4 || got.TimedOut {
+		t.Errorf("got stdout %q, exit code %d, timed out %t, want \"abab\\n\", 4 and false", got.Stdout, got.ExitCode, got.TimedOut)
+	}
+	if got.RequestID == "" || resp.Header.Get("X-Request-ID") != got.RequestID {
+		t.Errorf("request ID %q does not match the header %q", got.RequestID, resp.Header.Get("X-Request-ID"))
+	}
+}
+
+// postRun posts body to /run of ts and decodes the response into v,
+// returning its status.
+func postRun(t *testing.T, ts *httptest.Server, body string, v any) int {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/run", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestRunFake(t *testing.T) {
+	fd := &fakeDocker{program: func(stdin string) (string, string, int) {
+		return strings.Repeat(strings.TrimSpace(stdin), 2) + "\n", "", 4
+	}}
+	ts := newFakeServer(t, fd)
+
+	var got runResponse
+	body := `{"language": "python", "files": {"main.py": "print(input() * 2)\n"}, "stdin": "ab\n"}`
+	if status := postRun(t, ts, body, &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if got.Stdout != "abab\n" || got.ExitCode != 4 || got.TimedOut {
+		t.Errorf("got stdout %q, exit code %d, timed out %t, want \"abab\\n\", 4 and false", got.Stdout, got.ExitCode, got.TimedOut)
+	}
+	if got.RequestID == "" {
+		t.Error("the response carries no request ID")
+	}
+}
+
+func TestRunClampsLimits(t *testing.T) {
+	fd := &fakeDocker{program: func(stdin string) (string, string, int) {
+		return strings.Repeat("x", maxOutputBytes+1), "", 0
+	}}
+	ts := newFakeServer(t, fd)
+
+	var got runResponse
+	body := `{"files": {"main.py": ""}, "memory_bytes": 8589934592, "cpus": 64, "max_output_bytes": 1073741824}`
+	if status := postRun(t, ts, body, &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	_, hostConfig := fd.created()
+	if hostConfig.Memory != maxMemoryBytes {
+		t.Errorf("Memory = %d, want the maximum of %d", hostConfig.Memory, maxMemoryBytes)
+	}
+	if cpus := float64(hostConfig.CPUQuota) / float64(hostConfig.CPUPeriod); cpus != maxCPUs {
+		t.Errorf("CPU quota of %g CPUs, want the maximum of %d", cpus, maxCPUs)
+	}
+	if !got.OutputTruncated || len(got.Stdout) > maxOutputBytes {
+		t.Errorf("got %d bytes of output, truncated %t, want at most the maximum of %d", len(got.Stdout), got.OutputTruncated, maxOutputBytes)
+	}
+}
+
+func TestRunErrorStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		createErr error
+		status    int
+	}{
+		{name: "unknown language", body: `{"language": "cobol", "files": {"main.cob": ""}}`, status: http.StatusBadRequest},
+		{name: "ambiguous language", body: `{"files": {"main.py": "", "main.js": ""}}`, status: http.StatusBadRequest},
+		{name: "missing entry file", body: `{"files": {"main.py": ""}, "entry_file": "app.py"}`, status: http.StatusBadRequest},
+		{name: "escaping file", body: `{"files": {"../main.py": ""}}`, status: http.StatusBadRequest},
+		{name: "file too large", body: `{"files": {"main.py": "` + strings.Repeat("x", 2<<20) + `"}}`, status: http.StatusBadRequest},
+		{name: "negative cpus", body: `{"files": {"main.py": ""}, "cpus": -1}`, status: http.StatusBadRequest},
+		{name: "negative output", body: `{"files": {"main.py": ""}, "max_output_bytes": -1}`, status: http.StatusBadRequest},
+		{name: "daemon failure", body: `{"files": {"main.py": ""}}`, createErr: errors.New("no space left on device"), status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		fd := &fakeDocker{
+			program:   func(stdin string) (string, string, int) { return "", "", 0 },
+			createErr: tt.createErr,
+		}
+		ts := newFakeServer(t, fd)
+
+		var got errorResponse
+		if status := postRun(t, ts, tt.body, &got); status != tt.status {
+			t.Errorf("%s: status = %d (%s), want %d", tt.name, status, got.Error, tt.status)
+		}
+		if got.Error == "" {
+			t.Errorf("%s: the response carries no error", tt.name)
+		}
+	}
+}
+
+func TestRunRejectsBadRequests(t *testing.T) {
+	ts := httptest.NewServer(New(runner.New(pingClient{})))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{name: "method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "malformed", method: http.MethodPost, body: "{", status: http.StatusBadRequest},
+		{name: "no files", method: http.MethodPost, body: `{"language": "python"}`, status: http.StatusBadRequest},
+		{name: "negative memory", method: http.MethodPost, body: `{"files": {"main.py": ""}, "memory_bytes": -1}`, status: http.StatusBadRequest},
+		{name: "timeout", method: http.MethodPost, body: `{"files": {"main.py": ""}, "timeout_ms": 3600000}`, status: http.StatusBadRequest},
+		{name: "too large", method: http.MethodPost, body: `{"files": {"main.py": "` + strings.Repeat("x", maxBodyBytes) + `"}}`, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, ts.URL+"/run", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got errorResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if err != nil || got.Error == "" {
+			t.Errorf("%s: the response carries no error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{status: http.StatusOK},
+		{err: errors.New("daemon unreachable"), status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(New(runner.New(pingClient{err: tt.err})))
+		resp, err := http.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		ts.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("Ping error %v: status = %d, want %d", tt.err, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestRunLogsRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	ts := httptest.NewServer(New(runner.New(pingClient{})))
+	defer ts.Close()
+
+	// An unknown language fails the run before the daemon is needed.
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/run", strings.NewReader(`{"language": "cobol", "files": {"main.cob": ""}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "req-7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); got != "req-7" {
+		t.Errorf("X-Request-ID = %q, want req-7", got)
+	}
+	if !strings.Contains(logs.String(), "request_id=req-7 ") {
+		t.Errorf("logs = %q, want the request ID in them", logs.String())
+	}
+}
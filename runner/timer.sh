@@ -1,12 +1,53 @@
 # !/bin/sh
 
-runCmd="python3 prima.py"
+# Runs the command given as arguments, e.g. `sh ./timer.sh python3 main.py`,
+# and exits with its status. It does not limit how long the command runs:
+# RunRequest.Timeout is enforced by the runner, which stops the container.
+#
+# When GNU time is available, a final line of the form
+#   __RUNNER_TIMING__ <wall seconds> <user seconds> <system seconds>
+# is written to stderr once the command exits. The runner parses it into the
+# run's timings and strips it from the captured stderr.
+#
+# `docker stop` only signals the container's main process, which is this
+# script. The command therefore runs under `timeout 0`, which never times out
+# but leads a process group of its own and relays a SIGTERM to everything in
+# it. With a terminal, that group could not read from it, so timeout stays in
+# the foreground and only signals GNU time, which leaves no grace period.
 
-# time (
-timeout 1s sh <<EOF
-    echo "==== Program Output"
-    echo "2" | $runCmd
-EOF
-# )
+if /usr/bin/time --version >/dev/null 2>&1; then
+    set -- /usr/bin/time -q -f "__RUNNER_TIMING__ %e %U %S" "$@"
+fi
+if [ -t 0 ] || [ -t 1 ]; then
+    set -- timeout --foreground 0 "$@"
+else
+    set -- timeout 0 "$@"
+fi
 
-echo "==== Code: $?"
\ No newline at end of file
+# Background commands would read from /dev/null otherwise.
+exec 3<&0
+"$@" <&3 3<&- &
+child=$!
+exec 3<&-
+
+term=
+trap 'term=1; kill -TERM "$child"' TERM
+
+# wait returns early when the trap runs, so keep waiting until timeout has
+# exited.
+wait "$child"
+status=$?
+while kill -0 "$child" 2>/dev/null; do
+    wait "$child"
+    status=$?
+done
+
+# GNU time dies of the SIGTERM right away, so the command may still be
+# finishing up. Wait for the process group timeout led to empty before exiting
+# takes the container down.
+if [ -n "$term" ]; then
+    while kill -0 -"$child" 2>/dev/null; do
+        sleep 0.1
+    done
+fi
+exit "$status"
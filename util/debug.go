@@ -3,16 +3,37 @@ package util
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 )
 
-func dbg(v any, die ...bool) {
+var (
+	debugMu sync.Mutex
+
+	// DebugEnabled turns Debugf on. It defaults to true when the RUNNER_DEBUG
+	// environment variable is set to a non-empty value.
+	DebugEnabled = os.Getenv("RUNNER_DEBUG") != ""
+
+	// DebugOutput is where Debugf writes to.
+	DebugOutput io.Writer = os.Stderr
+)
+
+// Debugf writes v as indented JSON to DebugOutput when DebugEnabled is set,
+// and does nothing otherwise. Values that cannot be encoded are written with
+// their %+v formatting instead.
+func Debugf(v any) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+
+	if !DebugEnabled || DebugOutput == nil {
+		return
+	}
+
 	w, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
-		panic(err)
-	}
-	fmt.Println(string(w))
-	if len(die) >= 1 && die[0] {
-		os.Exit(1)
+		fmt.Fprintf(DebugOutput, "%+v\n", v)
+		return
 	}
+	fmt.Fprintln(DebugOutput, string(w))
 }
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+// captureDebug points DebugOutput to a buffer and sets DebugEnabled for the
+// rest of the test.
+func captureDebug(t *testing.T, enabled bool) *bytes.Buffer {
+	t.Helper()
+	output, wasEnabled := DebugOutput, DebugEnabled
+	t.Cleanup(func() {
+		DebugOutput, DebugEnabled = output, wasEnabled
+	})
+
+	var buf bytes.Buffer
+	DebugOutput, DebugEnabled = &buf, enabled
+	return &buf
+}
+
+func TestDebugfEnabled(t *testing.T) {
+	buf := captureDebug(t, true)
+
+	Debugf([]string{"main.py"})
+	if want := "[\n\t\"main.py\"\n]\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestDebugfUnencodable(t *testing.T) {
+	buf := captureDebug(t, true)
+
+	Debugf(func() {})
+	if buf.Len() == 0 {
+		t.Error("nothing was written for a value JSON cannot encode")
+	}
+}
+
+func TestDebugfDisabled(t *testing.T) {
+	buf := captureDebug(t, false)
+
+	Debugf([]string{"main.py"})
+	if buf.Len() != 0 {
+		t.Errorf("output = %q, want none", buf.String())
+	}
+}